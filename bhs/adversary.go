@@ -0,0 +1,219 @@
+package bhs
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// Policy is how an adversarial scheduler picks the next agent to act
+type Policy uint8
+
+// Policies
+const (
+	RandomPolicy        Policy = iota // 0: any waiting agent
+	RoundRobinPolicy                  // 1: waiting agents take turns in the order they joined
+	StarvePolicy                      // 2: one agent, picked from the seed, only acts once it's the last one left or the others only wait
+	NearBlackHolePolicy               // 3: the agent closest to the black hole acts last
+)
+
+// AdversarialScheduler lets a single agent act at a time, every move and whiteboard access waits for its turn
+// An agent is only picked once every agent is waiting, so a run is reproduced exactly from its policy and seed
+// Agents that only wait, e.g. for another one to get somewhere, are picked once all of them do, so none of them is picked forever
+type AdversarialScheduler struct {
+	sync.Mutex
+	turn      *sync.Cond
+	policy    Policy
+	random    *rand.Rand
+	agents    []*Agent // in the order they joined
+	waiting   map[*Agent]Action
+	running   *Agent
+	previous  int // index of the last agent picked
+	victim    *Agent
+	distances []NodeID // from each node to the closest black or gray hole, for NearBlackHolePolicy
+	started   bool
+	time      uint64
+	woken     bool // once the search is cancelled, agents no longer wait for their turn
+}
+
+// NewAdversarialScheduler helps construct an adversarial scheduler
+func NewAdversarialScheduler(policy Policy, seed int64) *AdversarialScheduler {
+	scheduler := &AdversarialScheduler{policy: policy, random: rand.New(rand.NewSource(seed)), waiting: make(map[*Agent]Action), previous: -1}
+	scheduler.turn = sync.NewCond(scheduler)
+	return scheduler
+}
+
+// Join adds an agent to the agents being scheduled
+func (scheduler *AdversarialScheduler) Join(agent *Agent) {
+	scheduler.Lock()
+	scheduler.agents = append(scheduler.agents, agent)
+	scheduler.Unlock()
+}
+
+// Leave removes an agent from the agents being scheduled, and hands the turn over if it was acting
+func (scheduler *AdversarialScheduler) Leave(agent *Agent) {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+
+	for i, joined := range scheduler.agents {
+		if joined != agent {
+			continue
+		}
+		scheduler.agents = append(scheduler.agents[:i], scheduler.agents[i+1:]...)
+		if i <= scheduler.previous {
+			scheduler.previous--
+		}
+		delete(scheduler.waiting, agent)
+		if scheduler.running == agent {
+			scheduler.running = nil
+		}
+		scheduler.dispatch()
+		return
+	}
+}
+
+// Start lets the first agent act once every agent that joined is waiting
+func (scheduler *AdversarialScheduler) Start() {
+	scheduler.Lock()
+	scheduler.started = true
+	if scheduler.policy == StarvePolicy && len(scheduler.agents) > 0 {
+		scheduler.victim = scheduler.agents[scheduler.random.Intn(len(scheduler.agents))]
+	}
+	if scheduler.policy == NearBlackHolePolicy && len(scheduler.agents) > 0 {
+		scheduler.distances = distancesToBlackHoles(scheduler.agents[0].topology)
+	}
+	scheduler.dispatch()
+	scheduler.Unlock()
+}
+
+// Step blocks the agent until the policy picks it
+func (scheduler *AdversarialScheduler) Step(agent *Agent, action Action) {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+
+	scheduler.waiting[agent] = action
+	if scheduler.running == agent {
+		scheduler.running = nil
+	}
+	scheduler.dispatch()
+	for scheduler.running != agent && !scheduler.woken {
+		scheduler.turn.Wait()
+	}
+	delete(scheduler.waiting, agent)
+	scheduler.time++
+}
+
+// wake lets every agent waiting for its turn go, they stop as their search was cancelled
+func (scheduler *AdversarialScheduler) wake() {
+	scheduler.Lock()
+	scheduler.woken = true
+	scheduler.turn.Broadcast()
+	scheduler.Unlock()
+}
+
+// Time returns the number of actions scheduled so far
+func (scheduler *AdversarialScheduler) Time() uint64 {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	return scheduler.time
+}
+
+// dispatch picks the next agent if nobody is acting and every agent is waiting, must be called with the lock held
+func (scheduler *AdversarialScheduler) dispatch() {
+	if !scheduler.started || scheduler.running != nil || len(scheduler.waiting) == 0 || len(scheduler.waiting) < len(scheduler.agents) {
+		return
+	}
+
+	scheduler.previous = scheduler.pick(scheduler.ready())
+	scheduler.running = scheduler.agents[scheduler.previous]
+	scheduler.turn.Broadcast()
+}
+
+// ready returns the indexes of the agents that may act next, those not waiting with a WaitAction unless they all are
+func (scheduler *AdversarialScheduler) ready() []int {
+	var ready, all []int
+	for i, agent := range scheduler.agents {
+		if scheduler.waiting[agent] != WaitAction {
+			ready = append(ready, i)
+		}
+		all = append(all, i)
+	}
+	if len(ready) == 0 {
+		return all
+	}
+	return ready
+}
+
+// pick returns the index of the next agent to act among the ready ones, every agent is waiting
+func (scheduler *AdversarialScheduler) pick(ready []int) int {
+	switch scheduler.policy {
+	case RoundRobinPolicy:
+		for _, i := range ready {
+			if i > scheduler.previous {
+				return i
+			}
+		}
+		return ready[0]
+	case StarvePolicy:
+		victim := scheduler.indexOf(scheduler.victim)
+		var others []int
+		for _, i := range ready {
+			if i != victim {
+				others = append(others, i)
+			}
+		}
+		if len(others) == 0 {
+			return ready[0]
+		}
+		return others[scheduler.random.Intn(len(others))]
+	case NearBlackHolePolicy:
+		if scheduler.distances == nil { // no agent had joined at the start
+			scheduler.distances = distancesToBlackHoles(scheduler.agents[ready[0]].topology)
+		}
+		farthest, candidates := NodeID(0), []int{}
+		for _, i := range ready {
+			distance := scheduler.distances[scheduler.agents[i].position.ID]
+			if distance > farthest || len(candidates) == 0 {
+				farthest, candidates = distance, []int{}
+			}
+			if distance == farthest {
+				candidates = append(candidates, i)
+			}
+		}
+		return candidates[scheduler.random.Intn(len(candidates))]
+	}
+	return ready[scheduler.random.Intn(len(ready))]
+}
+
+func (scheduler *AdversarialScheduler) indexOf(agent *Agent) int {
+	for i, joined := range scheduler.agents {
+		if joined == agent {
+			return i
+		}
+	}
+	return -1
+}
+
+// distancesToBlackHoles returns the number of links from each node to the closest black (or gray) hole, the size of the topology if none is reachable
+// A single search from every hole at once, so the scheduler picks agents without searching the topology each time
+func distancesToBlackHoles(topology Topology) []NodeID {
+	size := NodeID(topology.Size())
+	distances, queue := make([]NodeID, size), []NodeID{}
+	for id := NodeID(0); id < size; id++ {
+		distances[id] = size
+		if node := peek(topology, id); node != nil && (node.BlackHole || node.IsGrayHole()) {
+			distances[id] = 0
+			queue = append(queue, id)
+		}
+	}
+	for ; len(queue) > 0; queue = queue[1:] {
+		id := queue[0]
+		for port := 0; port < topology.Ports(id); port++ {
+			neighbour, _ := topology.Neighbour(id, Direction(port))
+			if distances[neighbour] == size {
+				distances[neighbour] = distances[id] + 1
+				queue = append(queue, neighbour)
+			}
+		}
+	}
+	return distances
+}
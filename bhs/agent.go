@@ -1,118 +1,172 @@
 package bhs
 
-import "fmt"
-
-// Agent is an abstraction of agents that move around the ring
+// Agent is an abstraction of agents that move around the ring, or any other topology
+// Agents only see the whiteboard and ports of the node they are on
 type Agent struct {
 	Direction      Direction
-	Position       *Node
-	Ring           Ring
+	position       *Node
+	topology       Topology
 	Active         bool
 	Moves          uint64
 	cautiousWalk   bool
 	UnexploredSet  [2]NodeID
 	ActAsSmall     bool
 	HomebaseNodeID NodeID
+	scheduler      Scheduler
+	onRing         bool      // whether the agent keeps its own sense of direction
+	leftPort       Direction // local port of the current node the agent sees as left
+	anonymous      bool      // whether the agent counts its location rather than reading node IDs
+	location       NodeID    // number of nodes left of the homebase, counted by the agent
+	arrival        Direction // local port of the current node the agent arrived through, None until it moves
+	homebase       NodeID    // ID of the node the agent started from, which it doesn't see in an anonymous ring
+	id             uint64    // number given by the tracer of the ring, if any
+	terminated     bool
+	ended          bool        // whether Terminate was called, once the agent's goroutine is over rather than on destruction
+	execution      *execution  // nil unless the search runs with RunContext
+	index          int         // number given by the execution, if any
+	scratch        scratchNode // node the agent stands on in a compact ring, while it needs none of it allocated
+	legs           []leg       // room for the legs of a move, kept from one move to the next
 }
 
 // NewAgent helps construct an agent
-func NewAgent(direction Direction, ring Ring, cautiousWalk bool) *Agent {
-	unexploredSet := [2]NodeID{1, NodeID(len(ring) - 1)}
-	homebaseNodeID := NodeID(0)
-	return &Agent{direction, ring[homebaseNodeID], ring, true, 0, cautiousWalk, unexploredSet, true, homebaseNodeID}
+// The agent joins the scheduler if one is given, otherwise it moves freely
+func NewAgent(direction Direction, topology Topology, cautiousWalk bool, scheduler Scheduler) *Agent {
+	return NewAgentAt(direction, topology, cautiousWalk, scheduler, 0)
 }
 
-// Move combines logic for moving left and right
-func (agent *Agent) Move(direction Direction) (updateFound bool, err error) {
-	if !agent.Active {
-		return false, fmt.Errorf("non-active agent can't move")
+// NewAgentAt helps construct an agent starting from the given homebase rather than node 0
+// In an anonymous ring, the agent counts its location from there, its HomebaseNodeID is then 0
+func NewAgentAt(direction Direction, topology Topology, cautiousWalk bool, scheduler Scheduler, homebaseNodeID NodeID) *Agent {
+	ring, onRing := topology.(Ring)
+	agent := &Agent{direction, nil, topology, true, 0, cautiousWalk, [2]NodeID{}, true, homebaseNodeID, scheduler, onRing, Left, onRing && ring.anonymous, 0, None, homebaseNodeID, 0, false, false, nil, 0, scratchNode{}, nil}
+	agent.position = agent.nodeAt(homebaseNodeID)
+	// the homebase and the unexplored set are where the agent sees them, counted from the homebase in an anonymous ring
+	ringSize := NodeID(topology.Size())
+	agent.HomebaseNodeID = agent.Location()
+	agent.UnexploredSet = [2]NodeID{(agent.HomebaseNodeID + 1) % ringSize, (agent.HomebaseNodeID + ringSize - 1) % ringSize}
+	agent.trace(AgentSpawned, homebaseNodeID, homebaseNodeID, None, unexplored)
+	if onRing {
+		ring.grayHoles.spawn(agent)
+	}
+	if onRing && ring.execution != nil {
+		agent.execution = ring.execution
+		agent.execution.join(agent)
 	}
+	if scheduler != nil {
+		scheduler.Join(agent)
+	}
+	return agent
+}
 
-	oppositeDirection := GetOppositeDirection(direction)
-	var outgoingEdgeLabel ExploredType
-	var sourceNodeWhiteboard *Whiteboard
+// Terminate tells the scheduler that the agent won't move anymore, deferred by the goroutine of the agent once it sent all it had to
+func (agent *Agent) Terminate() {
+	agent.ended = true
+	agent.stop()
+}
 
-	// cautious walk: mark edge as active before leaving, immediately come back to mark as explored if safe
-	if agent.cautiousWalk {
-		sourceNodeWhiteboard = agent.Position.whiteboard
-		sourceNodeWhiteboard.Lock()
-		if agent.checkForUpdate() { // always check for an update before moving
-			sourceNodeWhiteboard.Unlock()
-			return true, nil
-		}
-		outgoingEdgeLabel = sourceNodeWhiteboard.label[direction]
-		switch outgoingEdgeLabel {
-		case unexplored:
-			sourceNodeWhiteboard.label[direction] = active
-		case active:
-			sourceNodeWhiteboard.Unlock()
-			return false, fmt.Errorf("cannot cross an active link")
+// stop tells the scheduler that the agent won't move anymore, e.g. as it was destroyed
+func (agent *Agent) stop() {
+	if !agent.terminated && agent.Active {
+		agent.trace(AgentTerminated, agent.position.ID, agent.position.ID, None, unexplored)
+	}
+	agent.terminated = true
+	if agent.scheduler != nil {
+		agent.scheduler.Leave(agent)
+	}
+	if agent.execution != nil {
+		status := Done
+		if !agent.Active {
+			status = Lost
 		}
-		sourceNodeWhiteboard.Unlock()
+		agent.execution.update(agent, status, WaitAction)
 	}
+}
 
-	newIndex := agent.getNewIndex(direction)
-	agent.Position = agent.Ring[newIndex]
+// Move combines logic for moving left and right, or through any port of the current node
+// On a ring, left and right are the agent's own sense of direction: it starts from the port labels of its homebase and goes through MoveThrough
+func (agent *Agent) Move(direction Direction) (updateFound bool, err error) {
+	return agent.MoveThrough(agent.port(direction))
+}
 
-	if agent.Position.BlackHole {
-		agent.Active = false
-		return false, fmt.Errorf("reached a black hole")
+// MoveThrough moves the agent through a local port of the current node, all an agent of an unoriented ring sees
+// With cautious walk, the move may stop on the source or the destination when it finds an update
+func (agent *Agent) MoveThrough(port Direction) (updateFound bool, err error) {
+	move := agent.startMove(port)
+	for move.next() {
 	}
+	return move.updateFound, move.err
+}
 
-	agent.Moves++
-	if !agent.cautiousWalk {
-		return
-	}
+// destroy deactivates the agent on a node, or on the link between two nodes
+func (agent *Agent) destroy(node NodeID, to NodeID, port Direction) {
+	agent.Active = false
+	agent.trace(AgentDestroyed, node, to, port, unexplored)
+	agent.stop()
+}
 
-	// Arrived at destination, mark incoming edge label as explored
-	destinationSourceWhiteboard := agent.Position.whiteboard
-	destinationSourceWhiteboard.Lock()
-	destinationSourceWhiteboard.label[oppositeDirection] = explored
-	destinationSourceWhiteboard.Unlock()
+// Wait lets the agent stay put for one time unit
+// It is how agents measure time in a synchronous setting, other schedulers simply count it as an action
+func (agent *Agent) Wait() {
+	agent.step(WaitAction)
+}
 
-	// Update agent's unexplored set with node just visited
-	switch agent.Position.ID {
-	case agent.UnexploredSet[1]:
-		agent.UnexploredSet[1]-- // if the agent is located at the rightmost unexplored node, decrement the index of the rightmost unexplored node
-	case agent.UnexploredSet[0]:
-		agent.UnexploredSet[0]++ // if the agent is located at the leftmost unexplored node, increment the index of the leftmost unexplored node
+// Location returns the ID of the node the agent is on
+// In an anonymous ring, it is instead the number of nodes the agent counted left of its homebase
+func (agent *Agent) Location() NodeID {
+	if agent.anonymous {
+		return agent.location
 	}
+	return agent.position.ID
+}
 
-	if outgoingEdgeLabel != unexplored { // Stop here unless agent needs to go back to mark outgoing label as explored
-		return false, nil
+// locationThrough returns the location of the node behind a port of the current node, on a ring
+func (agent *Agent) locationThrough(port Direction) NodeID {
+	if !agent.anonymous {
+		next, _ := agent.topology.Neighbour(agent.position.ID, port)
+		return next
 	}
-
-	// go back to source to mark its outgoing edge label as explored and check for new instructions
-	if updateFound, err := agent.Move(oppositeDirection); err != nil || updateFound {
-		return updateFound, err
+	ringSize := NodeID(agent.topology.Size())
+	if port == agent.port(Left) {
+		return (agent.location + 1) % ringSize
 	}
+	return (agent.location + ringSize - 1) % ringSize
+}
 
-	// otherwise, keep doing your thing
-	if updateFound, err := agent.Move(direction); err != nil || updateFound {
-		return updateFound, err
-	}
+// Arrival returns the local port of the current node the agent arrived through, or None if it never moved
+// On a ring, the other port leads on the same way
+func (agent *Agent) Arrival() Direction {
+	return agent.arrival
+}
 
-	return false, nil // successful, nothing to declare
+// unexplored returns whether a location is in the agent's unexplored set, from its leftmost node to its rightmost one past node 0 if need be
+func (agent *Agent) unexplored(location NodeID) bool {
+	ringSize := NodeID(agent.topology.Size())
+	return (location+ringSize-agent.UnexploredSet[0])%ringSize <= (agent.UnexploredSet[1]+ringSize-agent.UnexploredSet[0])%ringSize
+}
+
+// Ports returns the number of ports of the node the agent is on
+func (agent *Agent) Ports() int {
+	return agent.topology.Ports(agent.position.ID)
 }
 
 // MoveUntil moves agent to the direction specified until it reaches a given index
 // Returns true if made it alive to the destination, otherwise false
 func (agent *Agent) MoveUntil(direction Direction, id NodeID) (bool, bool) {
-	for agent.Position.ID != id {
-		if updateFound, err := agent.Move(direction); err != nil || updateFound {
-			return err == nil, updateFound
-		}
+	walk := agent.walk(direction, id)
+	for !walk.Next() {
 	}
-	return true, false
+	return walk.Result()
 }
 
 // MoveToLastExplored is used for cautious walk
 func (agent *Agent) MoveToLastExplored(direction Direction) {
-	agent.Position.whiteboard.Lock()
-	for agent.Position.whiteboard.label[direction] == explored {
-		agent.Position.whiteboard.Unlock()
+	agent.step(WhiteboardAction)
+	agent.current().whiteboard.Lock()
+	for agent.position.whiteboard.label[agent.port(direction)] == explored {
+		agent.position.whiteboard.Unlock()
 		agent.Move(direction)
-		agent.Position.whiteboard.Lock()
+		agent.step(WhiteboardAction)
+		agent.current().whiteboard.Lock()
 	}
 }
 
@@ -177,23 +231,25 @@ func (agent *Agent) LeaveUpdate(remainingIterationsAsSmall uint8) {
 	oppositeDirection := GetOppositeDirection(agent.Direction)
 	agent.MoveToLastExplored(oppositeDirection)
 
-	whiteboard := agent.Position.whiteboard
+	whiteboard := agent.relock(agent.position.whiteboard)
 	// whiteboard.Lock() ALREADY LOCKED FROM PREVIOUS METHOD CALL
 
 	whiteboard.updateForAgent = oppositeDirection
+	written := agent.event(UpdateWritten, agent.position.ID, agent.position.ID, agent.port(oppositeDirection), unexplored)
 	if remainingIterationsAsSmall == 0 {
 		whiteboard.actAsSmall = agent.ActAsSmall
 		agent.ActAsSmall = !agent.ActAsSmall
 	}
 	// getting the halfway point of the unexplored set, then finding the node halfway around the ring from it should be the center of the explored set
 	// cannot do negative modulo, because NodeID is an unsigned integer
-	ringSize := NodeID(len(agent.Ring))
+	ringSize := NodeID(agent.topology.Size())
 	middleOfUnexploredSetNodeID := agent.UnexploredSet[0] + (agent.UnexploredSet[1]-agent.UnexploredSet[0])/2
 	whiteboard.homebaseNodeID = (ringSize/2 + middleOfUnexploredSetNodeID) % ringSize
 	agent.HomebaseNodeID = whiteboard.homebaseNodeID
 	whiteboard.unexploredSet = agent.UnexploredSet
 
 	whiteboard.Unlock()
+	written.emit()
 }
 
 // LeaveUpdateDivide is used for updating the other agent during the divide algorithm
@@ -201,35 +257,92 @@ func (agent *Agent) LeaveUpdateDivide() {
 	oppositeDirection := GetOppositeDirection(agent.Direction)
 	agent.MoveToLastExplored(oppositeDirection)
 
-	whiteboard := agent.Position.whiteboard
+	whiteboard := agent.relock(agent.position.whiteboard)
 	// whiteboard.Lock() ALREADY LOCKED FROM PREVIOUS METHOD CALL
 
 	whiteboard.updateForAgent = oppositeDirection
 	whiteboard.unexploredSet = agent.UnexploredSet
+	written := agent.event(UpdateWritten, agent.position.ID, agent.position.ID, agent.port(oppositeDirection), unexplored)
+
+	whiteboard.Unlock()
+	written.emit()
+}
+
+// LeaveUpdateDivideThrough is LeaveUpdateDivide for agents going by ports: it goes back through the given port, then through the one opposite to each it arrives through
+// It returns the port to go on exploring through, away from the way it came back
+func (agent *Agent) LeaveUpdateDivideThrough(port Direction) Direction {
+	agent.step(WhiteboardAction)
+	agent.current().whiteboard.Lock()
+	for agent.position.whiteboard.label[port] == explored {
+		agent.position.whiteboard.Unlock()
+		from := agent.position.ID
+		agent.MoveThrough(port)
+		if agent.position.ID != from { // the move may stop before leaving, on an update
+			port = GetOppositeDirection(agent.arrival)
+		}
+		agent.step(WhiteboardAction)
+		agent.current().whiteboard.Lock()
+	}
+
+	whiteboard := agent.relock(agent.position.whiteboard)
+	whiteboard.updateForAgent = GetOppositeDirection(agent.Direction)
+	whiteboard.unexploredSet = agent.UnexploredSet
+	written := agent.event(UpdateWritten, agent.position.ID, agent.position.ID, port, unexplored)
 
 	whiteboard.Unlock()
+	written.emit()
+	return GetOppositeDirection(port)
 }
 
-func (agent *Agent) getNewIndex(direction Direction) NodeID {
-	newID := agent.Position.ID
-	if direction == Right {
-		newID += NodeID(len(agent.Ring)) - 1 // go around the ring to previous node
-	} else if direction == Left {
-		newID++ // go to next node
+// port translates a direction into a local port of the current node
+func (agent *Agent) port(direction Direction) Direction {
+	if !agent.onRing || direction > Right {
+		return direction
+	}
+	if direction == Left {
+		return agent.leftPort
+	}
+	return GetOppositeDirection(agent.leftPort)
+}
+
+// track keeps the sense of direction and location after leaving through a port and arriving through another
+// port labels may differ from a node to the next, but the port leading back is always on the other side
+func (agent *Agent) track(port Direction, back Direction) {
+	if !agent.onRing {
+		return
+	}
+	ringSize := NodeID(agent.topology.Size())
+	if port == agent.leftPort { // went left, so back is right
+		agent.leftPort = GetOppositeDirection(back)
+		agent.location = (agent.location + 1) % ringSize
+	} else {
+		agent.leftPort = back
+		agent.location = (agent.location + ringSize - 1) % ringSize
+	}
+}
+
+// step waits for the scheduler to let the agent act, never call it while holding a whiteboard lock
+func (agent *Agent) step(action Action) {
+	if agent.execution != nil { // agents of a cancelled search stop here
+		agent.execution.update(agent, Scheduled, action)
+		defer agent.execution.update(agent, Running, action)
+	}
+	if agent.scheduler != nil {
+		agent.scheduler.Step(agent, action)
 	}
-	newID = newID % NodeID(len(agent.Ring))
-	return newID
 }
 
-func (agent *Agent) checkForUpdate() bool {
+// checkForUpdate reads the update on the whiteboard the agent holds the lock of, if it is for the agent
+// The event of reading it is for the caller to emit once it let go of the lock
+func (agent *Agent) checkForUpdate() (bool, traced) {
 	if agent.ActAsSmall { // only big agents check for updates
-		return false
+		return false, traced{}
 	}
 
-	whiteboard := agent.Position.whiteboard
+	whiteboard := agent.position.whiteboard
 
 	if whiteboard.unexploredSet == [2]NodeID{} || agent.Direction != whiteboard.updateForAgent {
-		return false
+		return false, traced{}
 	}
 
 	// store updates
@@ -240,8 +353,9 @@ func (agent *Agent) checkForUpdate() bool {
 	// erase unexplored set as an indicator that update was read
 	whiteboard.unexploredSet = [2]NodeID{}
 	whiteboard.updateForAgent = None
+	read := agent.event(UpdateRead, agent.position.ID, agent.position.ID, None, unexplored)
 
-	return true
+	return true, read
 }
 
 // GetOppositeDirection is self-explanatory
@@ -1,22 +1,23 @@
 package algorithms
 
-import (
-	"../../bhs"
-	"../../helpers"
-)
+import "../../bhs"
 
-// Divide is a black hole search algorithm that uses 2(n-1) agents
-func Divide(ring bhs.Ring) (bhs.NodeID, uint64, uint64) {
+// Divide is a black hole search algorithm that uses 2 agents
+func Divide(ring bhs.Ring, scheduler bhs.Scheduler) bhs.Result {
 	const cautiousWalk = true
-	blackhole := make(chan bhs.NodeID, 1)
+	team := bhs.NewTeam()
+	blackhole := make(chan bhs.NodeID, 2) // both agents may survive and report the black hole
 	oks := make(chan bool, 2)
 	moves := make(chan uint64, 2)
-	ringSize := bhs.NodeID(len(ring)) // logically wrong, but needed for type correctness)
+	ringSize := bhs.NodeID(ring.Size()) // logically wrong, but needed for type correctness)
 
 	directions := [2]bhs.Direction{bhs.Left, bhs.Right}
 	for i := 0; i < len(directions); i++ {
-		go func(direction bhs.Direction, oks chan<- bool, blackhole chan<- bhs.NodeID, moves chan<- uint64) {
-			agent := bhs.NewAgent(direction, ring, cautiousWalk)
+		agent := team.NewAgent(directions[i], ring, cautiousWalk, scheduler)
+		team.Add(1)
+		go func(agent *bhs.Agent, oks chan<- bool, blackhole chan<- bhs.NodeID, moves chan<- uint64) {
+			defer team.Done()
+			defer agent.Terminate()
 			agent.ActAsSmall = false // for update catching
 			agent.UnexploredSet = [2]bhs.NodeID{1, ringSize - 1}
 
@@ -40,11 +41,98 @@ func Divide(ring bhs.Ring) (bhs.NodeID, uint64, uint64) {
 			agent.MoveUntil(bhs.GetOppositeDirection(agent.Direction), 0) // go to homebase
 			blackhole <- agent.UnexploredSet[0]
 			moves <- agent.Moves
-		}(directions[i], oks, blackhole, moves)
+		}(agent, oks, blackhole, moves)
+	}
+	scheduler.Start()
+
+	movesAgent1, movesAgent2 := bhs.Receive(team, moves), bhs.Receive(team, moves)
+	return team.Result(bhs.Receive(team, blackhole), movesAgent1+movesAgent2, scheduler.Time())
+}
+
+// DivideMachines is Divide with agents written as state machines, which the engine steps on a single goroutine
+func DivideMachines(ring bhs.Ring, engine *bhs.Engine) bhs.Result {
+	const cautiousWalk = true
+	team := bhs.NewTeam()
+	search := &divideSearch{}
+	ringSize := bhs.NodeID(ring.Size()) // logically wrong, but needed for type correctness)
+
+	directions := [2]bhs.Direction{bhs.Left, bhs.Right}
+	for i := 0; i < len(directions); i++ {
+		agent := team.NewAgent(directions[i], ring, cautiousWalk, engine)
+		agent.ActAsSmall = false // for update catching
+		agent.UnexploredSet = [2]bhs.NodeID{1, ringSize - 1}
+		engine.Add(agent, &divideAgent{agent, search, nil, exploring})
 	}
+	engine.Start()
+
+	return team.Result(search.blackHole, search.moves, engine.Time())
+}
+
+// divideSearch is what the agents of Divide share as state machines
+type divideSearch struct {
+	moves     uint64
+	found     bool // once the first agent is back home, both may survive and report the black hole
+	blackHole bhs.NodeID
+}
+
+// divideState is what an agent of Divide walks for
+type divideState uint8
+
+// States
+const (
+	exploring divideState = iota // 0: half of the unexplored set, or until an update
+	updating                     // 1: back to the last explored link, to leave an update there
+	returning                    // 2: home, once a single node is left unexplored
+)
+
+// divideAgent explores half of what is left, and leaves an update for the other agent, until the black hole is all that's left
+type divideAgent struct {
+	agent  *bhs.Agent
+	search *divideSearch
+	walk   *bhs.Walk // in progress, nil between walks
+	state  divideState
+}
 
-	movesAgent1, movesAgent2 := <-moves, <-moves
-	return <-blackhole, movesAgent1 + movesAgent2, helpers.MaxUint64(movesAgent1, movesAgent2)
+func (machine *divideAgent) Step() bool {
+	agent, search := machine.agent, machine.search
+	for {
+		if machine.walk == nil {
+			switch {
+			case machine.state == updating:
+				machine.walk = agent.WalkToLastExplored(bhs.GetOppositeDirection(agent.Direction))
+			case agent.UnexploredSet[0] == agent.UnexploredSet[1]:
+				machine.state = returning
+				machine.walk = agent.Walk(bhs.GetOppositeDirection(agent.Direction), 0) // go to homebase
+			default:
+				machine.walk = agent.Walk(agent.Direction, equallyDivideUnexploredSet(agent.Direction, agent.UnexploredSet))
+			}
+		}
+		if !machine.walk.Next() {
+			return false
+		}
+
+		ok, updateFound := machine.walk.Result()
+		machine.walk = nil
+		switch machine.state {
+		case exploring:
+			if !ok {
+				search.moves += agent.Moves
+				return true
+			}
+			if !updateFound && agent.UnexploredSet[0] != agent.UnexploredSet[1] { // if other agent falls in the black hole, update useless
+				machine.state = updating
+			}
+		case updating:
+			agent.LeaveUpdateDivide() // right where the walk ended, without moving
+			machine.state = exploring
+		case returning:
+			search.moves += agent.Moves
+			if !search.found {
+				search.found, search.blackHole = true, agent.UnexploredSet[0]
+			}
+			return true
+		}
+	}
 }
 
 func equallyDivideUnexploredSet(direction bhs.Direction, unexploredSet [2]bhs.NodeID) bhs.NodeID {
@@ -6,9 +6,10 @@ import (
 )
 
 // Group is a black hole search algorithm that uses (n-1) agents
-func Group(ring bhs.Ring) (bhs.NodeID, uint64, uint64) {
+func Group(ring bhs.Ring, scheduler bhs.Scheduler) bhs.Result {
 	const cautiousWalk = false
-	n := uint64(len(ring))
+	team := bhs.NewTeam()
+	n := ring.Size()
 	q := (n - 1) / 4
 	a := n - 4*q
 
@@ -17,30 +18,30 @@ func Group(ring bhs.Ring) (bhs.NodeID, uint64, uint64) {
 	blackhole := make(chan bhs.NodeID, 1)
 	results := make(chan groupChannelResponse, n-1)
 	complexities := make(chan uint64, 2)
-	var previousTrigger chan bool
+	var previousTrigger chan groupTrigger
 
 	for groupIndex := uint64(1); groupIndex <= groupSizes[MiddleGroup]; groupIndex++ { // loop q+a times
-		currentTrigger := make(chan bool, 2)
+		currentTrigger := make(chan groupTrigger, 2)
 		for group := LeftGroup; group < 4; group++ {
 			if groupIndex > groupSizes[group] {
 				continue
 			}
-			go func(results chan<- groupChannelResponse, groupIndex uint64, group AgentGroup, iTrigger chan bool, iPlus1Trigger chan bool) {
-				if group == TieBreakerGroup {
-					if !<-iPlus1Trigger {
-						if !<-iPlus1Trigger {
-							return
-						}
-					}
+			agent := team.NewAgent(directions[group], ring, cautiousWalk, scheduler) // tie breakers too, so they all join before the start
+			team.Add(1)
+			go func(agent *bhs.Agent, results chan<- groupChannelResponse, groupIndex uint64, group AgentGroup, iTrigger chan<- groupTrigger, iPlus1Trigger <-chan groupTrigger) {
+				defer team.Done()
+				defer agent.Terminate()
+				if group == TieBreakerGroup && !released(agent, iPlus1Trigger, scheduler) { // it still reports so the results are complete
+					results <- groupChannelResponse{false, groupChannelResult{}, agent.Moves, group, groupIndex}
+					return
 				}
 				destinations := getDestinations(group, n, q, groupIndex)
-				agent := bhs.NewAgent(directions[group], ring, cautiousWalk)
 				oppositeDirection := bhs.GetOppositeDirection(agent.Direction)
 
 				ok, _ := agent.MoveUntil(agent.Direction, destinations[0])
 				agent.MoveUntil(oppositeDirection, destinations[1]) // homebase
 				if (group == LeftGroup || group == RightGroup) && iTrigger != nil {
-					iTrigger <- ok
+					iTrigger <- groupTrigger{ok, scheduler.Time()}
 				}
 				if !ok {
 					results <- groupChannelResponse{false, groupChannelResult{}, agent.Moves, group, groupIndex}
@@ -53,25 +54,22 @@ func Group(ring bhs.Ring) (bhs.NodeID, uint64, uint64) {
 				agent.MoveUntil(agent.Direction, destinations[3]) // homebase
 
 				results <- groupChannelResponse{true, groupChannelResult{agent.Direction, [2]bhs.NodeID{destinations[0], destinations[2]}}, agent.Moves, group, groupIndex}
-			}(results, groupIndex, group, previousTrigger, currentTrigger)
+			}(agent, results, groupIndex, group, previousTrigger, currentTrigger)
 		}
 
 		previousTrigger = currentTrigger
 	}
+	scheduler.Start()
 
 	// kinda cheating, because a trigger is used to notify that the agent isn't coming back, so we could technically know where the black hole is
+	team.Add(1)
 	go func(blackhole chan<- bhs.NodeID, results <-chan groupChannelResponse, complexities chan<- uint64) {
-		maxTime := uint64(0)
+		defer team.Done()
 		moveComplexity := uint64(0)
 		result := []groupChannelResult{}
 		for agent := uint64(0); agent < n-1; agent++ {
-			groupChannelResponse := <-results
+			groupChannelResponse := bhs.Receive(team, results)
 			moveComplexity += groupChannelResponse.moves
-			if groupChannelResponse.group == TieBreakerGroup {
-				maxTime = helpers.MaxUint64(maxTime, groupChannelResponse.moves+(groupChannelResponse.groupIndex)*2) // tiebreakers get released later
-			} else {
-				maxTime = helpers.MaxUint64(maxTime, groupChannelResponse.moves)
-			}
 			if !groupChannelResponse.success { // agent fell in black hole
 				continue
 			}
@@ -80,10 +78,32 @@ func Group(ring bhs.Ring) (bhs.NodeID, uint64, uint64) {
 
 		blackhole <- findMissing(result, n)
 		complexities <- moveComplexity
-		complexities <- maxTime
+		complexities <- scheduler.Time() // every agent is done moving, tie breakers included
 	}(blackhole, results, complexities)
 
-	return <-blackhole, <-complexities, <-complexities
+	blackHoleID, moves, time := bhs.Receive(team, blackhole), bhs.Receive(team, complexities), bhs.Receive(team, complexities)
+	return team.Result(blackHoleID, moves, time)
+}
+
+// released has a tie breaker wait at its homebase until an agent of the next groups comes back, false if both were destroyed
+// It sets off the round after the trigger came, whether its goroutine saw it then or a round later, so a run is replayed exactly
+func released(agent *bhs.Agent, trigger <-chan groupTrigger, scheduler bhs.Scheduler) bool {
+	for received := 0; received < 2; {
+		select {
+		case trigger := <-trigger:
+			received++
+			if !trigger.ok {
+				continue
+			}
+			for scheduler.Time() <= trigger.time {
+				agent.Wait()
+			}
+			return true
+		default:
+			agent.Wait()
+		}
+	}
+	return false
 }
 
 func getDestinations(group AgentGroup, n uint64, q uint64, i uint64) [4]bhs.NodeID {
@@ -15,6 +15,12 @@ type groupChannelResponse struct {
 	groupIndex uint64
 }
 
+// groupTrigger tells a tie breaker whether an agent of the next groups came back, and when
+type groupTrigger struct {
+	ok   bool
+	time uint64
+}
+
 // AgentGroup ...
 type AgentGroup uint8
 
@@ -0,0 +1,34 @@
+package algorithms
+
+import (
+	"fmt"
+
+	"../../bhs"
+)
+
+// ModelCheck runs the algorithm under every schedule of its agents that may change its outcome, on a ring with the given black hole
+// A run is rejected when it returns another node, deadlocks, or loses more agents than the algorithm claims it may
+// Only algorithms relying on cautious walk can be checked, the others rely on time and the synchronous scheduler
+func ModelCheck(algorithm Algorithm, blackHole bhs.NodeID, ringSize uint64, maxRuns int) (bhs.ModelCheckReport, error) {
+	if !algorithm.Model().CautiousWalk {
+		return bhs.ModelCheckReport{}, fmt.Errorf("%s relies on time, so it only runs with the synchronous scheduler", algorithm.Name())
+	}
+	if ringSize < algorithm.MinRingSize() {
+		return bhs.ModelCheckReport{}, fmt.Errorf("%s needs a ring of at least %d nodes", algorithm.Name(), algorithm.MinRingSize())
+	}
+
+	run := func(scheduler bhs.Scheduler) bhs.Result {
+		return algorithm.Run(algorithm.Model().BuildRing(blackHole, ringSize), scheduler)
+	}
+	claimed := algorithm.MaxLoss(ringSize)
+	check := func(result bhs.Result) error {
+		if result.BlackHole != blackHole {
+			return fmt.Errorf("returned node %d instead of the black hole %d", result.BlackHole, blackHole)
+		}
+		if result.Destroyed > claimed {
+			return fmt.Errorf("lost %d agents out of %d, while %s may only lose %d", result.Destroyed, result.TeamSize, algorithm.Name(), claimed)
+		}
+		return nil
+	}
+	return bhs.ModelCheck(run, check, maxRuns), nil
+}
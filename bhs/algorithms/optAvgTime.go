@@ -6,22 +6,24 @@ import (
 )
 
 // OptAvgTime is a black hole search algorithm that uses 2(n-1) agents
-func OptAvgTime(ring bhs.Ring) (bhs.NodeID, uint64, uint64) {
+func OptAvgTime(ring bhs.Ring, scheduler bhs.Scheduler) bhs.Result {
 	const cautiousWalk = false
+	team := bhs.NewTeam()
 	blackHole := make(chan bhs.NodeID, 1) // channel to send the index, buffered to one
-	totalMoves := make(chan uint64, 2*(len(ring)-1))
+	totalMoves := make(chan uint64, 2*(ring.Size()-1))
 	idealTime := make(chan uint64, 1)
-	ringSize := bhs.NodeID(len(ring)) // logically wrong, but needed for type correctness
+	ringSize := bhs.NodeID(ring.Size()) // logically wrong, but needed for type correctness
 
 	for id := bhs.NodeID(1); id < ringSize; id++ {
-		oks := make(chan bool, 2) // results from left and right agent
-		moves := make(chan uint64, 2)
+		oks := make(chan bool, 2)     // results from left and right agent
+		times := make(chan uint64, 2) // time at which left and right agent are back home
 
 		directions := [2]bhs.Direction{bhs.Left, bhs.Right}
 		destinations := [2]bhs.NodeID{id - 1, (1 + id) % ringSize}
 		for i := 0; i < len(directions); i++ {
-			go func(destination bhs.NodeID, oks chan<- bool, moves chan<- uint64, direction bhs.Direction) {
-				agent := bhs.NewAgent(direction, ring, cautiousWalk)
+			agent, destination := team.NewAgent(directions[i], ring, cautiousWalk, scheduler), destinations[i]
+			team.Go(scheduler, func() {
+				defer agent.Terminate()
 
 				if ok, _ := agent.MoveUntil(agent.Direction, destination); !ok {
 					oks <- false
@@ -31,31 +33,117 @@ func OptAvgTime(ring bhs.Ring) (bhs.NodeID, uint64, uint64) {
 
 				ok, _ := agent.MoveUntil(bhs.GetOppositeDirection(agent.Direction), agent.HomebaseNodeID)
 				oks <- ok
-				moves <- agent.Moves
+				times <- scheduler.Time()
 				totalMoves <- agent.Moves
-			}(destinations[i], oks, moves, directions[i])
+			})
 		}
 
 		// check for results from left and right agents
-		go func(id bhs.NodeID, oks <-chan bool, results <-chan uint64) {
-			if ok := <-oks; !ok {
+		team.Go(scheduler, func() {
+			if ok := bhs.Receive(team, oks); !ok {
 				return
 			}
 
-			if ok := <-oks; !ok {
+			if ok := bhs.Receive(team, oks); !ok {
 				return
 			}
 
 			// both agents have returned true, alert the index of the black hole
-			blackHole <- id
-			idealTime <- helpers.MaxUint64(<-results, <-results)
-		}(id, oks, moves)
+			// unless another node was, as a gray hole lets some agents through
+			select {
+			case blackHole <- id:
+				idealTime <- helpers.MaxUint64(bhs.Receive(team, times), bhs.Receive(team, times))
+			default:
+			}
+		})
 	}
+	scheduler.Start()
 
 	var sumMoves uint64
-	for i := 1; i < len(ring); i++ {
-		sumMoves += <-totalMoves + <-totalMoves
+	for i := uint64(1); i < ring.Size(); i++ {
+		sumMoves += bhs.Receive(team, totalMoves) + bhs.Receive(team, totalMoves)
 	}
 	// wait for the black hole to be found
-	return <-blackHole, sumMoves, <-idealTime
+	return team.Result(bhs.Receive(team, blackHole), sumMoves, bhs.Receive(team, idealTime))
+}
+
+// OptAvgTimeMachines is OptAvgTime with agents written as state machines, which the engine steps on a single goroutine
+func OptAvgTimeMachines(ring bhs.Ring, engine *bhs.Engine) bhs.Result {
+	const cautiousWalk = false
+	team := bhs.NewTeam()
+	search := &optAvgTimeSearch{engine: engine}
+	ringSize := bhs.NodeID(ring.Size()) // logically wrong, but needed for type correctness
+
+	for id := bhs.NodeID(1); id < ringSize; id++ {
+		pair := &optAvgTimePair{id: id}
+		directions := [2]bhs.Direction{bhs.Left, bhs.Right}
+		destinations := [2]bhs.NodeID{id - 1, (1 + id) % ringSize}
+		for i := 0; i < len(directions); i++ {
+			agent := team.NewAgent(directions[i], ring, cautiousWalk, engine)
+			engine.Add(agent, &optAvgTimeAgent{agent, search, pair, destinations[i], nil, false})
+		}
+	}
+	engine.Start()
+
+	return team.Result(search.blackHole, search.moves, search.idealTime)
+}
+
+// optAvgTimeSearch is what the agents of OptAvgTime share as state machines
+type optAvgTimeSearch struct {
+	engine    *bhs.Engine
+	moves     uint64
+	found     bool // once the first pair is back home, only it reports as a gray hole lets some agents through
+	blackHole bhs.NodeID
+	idealTime uint64
+}
+
+// optAvgTimePair is what the left and right agents checking a node report
+type optAvgTimePair struct {
+	id       bhs.NodeID
+	reported int  // agents that reported so far
+	ok       bool // whether every agent that reported is back home
+	time     uint64
+}
+
+// optAvgTimeAgent visits one neighbour of the node its pair checks, then goes back home
+type optAvgTimeAgent struct {
+	agent       *bhs.Agent
+	search      *optAvgTimeSearch
+	pair        *optAvgTimePair
+	destination bhs.NodeID
+	walk        *bhs.Walk // in progress, nil between walks
+	returning   bool
+}
+
+func (machine *optAvgTimeAgent) Step() bool {
+	agent, search, pair := machine.agent, machine.search, machine.pair
+	for {
+		switch {
+		case machine.walk != nil:
+		case machine.returning:
+			machine.walk = agent.Walk(bhs.GetOppositeDirection(agent.Direction), agent.HomebaseNodeID)
+		default:
+			machine.walk = agent.Walk(agent.Direction, machine.destination)
+		}
+		if !machine.walk.Next() {
+			return false
+		}
+
+		ok, _ := machine.walk.Result()
+		machine.walk = nil
+		if ok && !machine.returning {
+			machine.returning = true
+			continue
+		}
+
+		search.moves += agent.Moves
+		pair.ok = (pair.reported == 0 || pair.ok) && ok
+		pair.reported++
+		pair.time = helpers.MaxUint64(pair.time, search.engine.Time())
+		// both agents have returned true, alert the index of the black hole
+		if pair.reported == 2 && pair.ok && !search.found {
+			search.found, search.blackHole, search.idealTime = true, pair.id, pair.time
+		}
+		return true
+	}
 }
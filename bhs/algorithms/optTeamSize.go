@@ -1,23 +1,24 @@
 package algorithms
 
-import (
-	"../../bhs"
-	"../../helpers"
-)
+import "../../bhs"
 
 // OptTeamSize is a black hole search algorithm that uses 2 agents
-func OptTeamSize(ring bhs.Ring) (bhs.NodeID, uint64, uint64) {
+func OptTeamSize(ring bhs.Ring, scheduler bhs.Scheduler) bhs.Result {
 	const cautiousWalk = true
-	blackHole := make(chan bhs.NodeID, 1) // channel to send the index, buffered to one
+	team := bhs.NewTeam()
+	blackHole := make(chan bhs.NodeID, 2) // channel to send the index, buffered to two as both agents may survive
 	moves := make(chan uint64, 2)         // channel to send the move cost for each agent
-	ringSize := bhs.NodeID(len(ring))     // logically wrong, but needed for type correctness
+	ringSize := bhs.NodeID(ring.Size())   // logically wrong, but needed for type correctness
 	phaseOneNodesToExplore := (ringSize - 1) / 2
 
 	directions := [2]bhs.Direction{bhs.Left, bhs.Right}
 	phaseOneDestinations := [2]bhs.NodeID{phaseOneNodesToExplore, ringSize - phaseOneNodesToExplore}
 	for i := 0; i < len(directions); i++ {
-		go func(direction bhs.Direction, destination bhs.NodeID, blackHole chan<- bhs.NodeID, moves chan<- uint64) {
-			agent := bhs.NewAgent(direction, ring, cautiousWalk)
+		agent := team.NewAgent(directions[i], ring, cautiousWalk, scheduler)
+		team.Add(1)
+		go func(agent *bhs.Agent, destination bhs.NodeID, blackHole chan<- bhs.NodeID, moves chan<- uint64) {
+			defer team.Done()
+			defer agent.Terminate()
 			agent.ActAsSmall = false
 
 			ok, updateFound := agent.MoveUntil(agent.Direction, destination)
@@ -46,10 +47,169 @@ func OptTeamSize(ring bhs.Ring) (bhs.NodeID, uint64, uint64) {
 			agent.ActAsSmall = true
 			agent.Small(2, blackHole, moves)
 
-		}(directions[i], phaseOneDestinations[i], blackHole, moves)
+		}(agent, phaseOneDestinations[i], blackHole, moves)
+	}
+	scheduler.Start()
+
+	agent1Moves, agent2Moves := bhs.Receive(team, moves), bhs.Receive(team, moves)
+
+	return team.Result(bhs.Receive(team, blackHole), agent1Moves+agent2Moves, scheduler.Time())
+}
+
+// OptTeamSizeMachines is OptTeamSize with agents written as state machines, which the engine steps on a single goroutine
+func OptTeamSizeMachines(ring bhs.Ring, engine *bhs.Engine) bhs.Result {
+	const cautiousWalk = true
+	team := bhs.NewTeam()
+	search := &optTeamSizeSearch{}
+	ringSize := bhs.NodeID(ring.Size()) // logically wrong, but needed for type correctness
+	phaseOneNodesToExplore := (ringSize - 1) / 2
+
+	directions := [2]bhs.Direction{bhs.Left, bhs.Right}
+	phaseOneDestinations := [2]bhs.NodeID{phaseOneNodesToExplore, ringSize - phaseOneNodesToExplore}
+	for i := 0; i < len(directions); i++ {
+		agent := team.NewAgent(directions[i], ring, cautiousWalk, engine)
+		agent.ActAsSmall = false
+		engine.Add(agent, &optTeamSizeAgent{agent, search, phaseOneDestinations[i], nil, goingOut, 0})
 	}
+	engine.Start()
+
+	return team.Result(search.blackHole, search.moves, engine.Time())
+}
+
+// optTeamSizeSearch is what the agents of OptTeamSize share as state machines
+type optTeamSizeSearch struct {
+	moves     uint64
+	found     bool // both agents may survive and report the black hole
+	blackHole bhs.NodeID
+}
+
+// optTeamSizeState is what an agent of OptTeamSize walks for, Small and Big each take a few of them
+type optTeamSizeState uint8
 
-	agent1Moves, agent2Moves := <-moves, <-moves
+// States
+const (
+	goingOut   optTeamSizeState = iota // 0: phase one, to the middle of the agent's half
+	comingBack                         // 1: phase one, home
+	smallOut                           // 2: small, to the next unexplored node
+	smallHome                          // 3: small, home
+	leaving                            // 4: to the last explored link, to leave an update there
+	bigOut                             // 5: big, to all but one of the unexplored nodes
+	reporting                          // 6: home, with the black hole all that's left
+)
+
+// optTeamSizeAgent takes the walks of Small and Big one after the other, as the updates it finds tell it to
+type optTeamSizeAgent struct {
+	agent       *bhs.Agent
+	search      *optTeamSizeSearch
+	destination bhs.NodeID // of phase one
+	walk        *bhs.Walk  // in progress, nil between walks
+	state       optTeamSizeState
+	remaining   uint8 // iterations left as small
+}
 
-	return <-blackHole, agent1Moves + agent2Moves, helpers.MaxUint64(agent1Moves, agent2Moves)
+func (machine *optTeamSizeAgent) Step() bool {
+	agent, search := machine.agent, machine.search
+	opposite := bhs.GetOppositeDirection(agent.Direction)
+	for {
+		if machine.walk == nil {
+			switch machine.state {
+			case goingOut:
+				machine.walk = agent.Walk(agent.Direction, machine.destination)
+			case comingBack, smallHome, reporting:
+				machine.walk = agent.Walk(opposite, agent.HomebaseNodeID)
+			case smallOut:
+				machine.walk = agent.Walk(agent.Direction, agent.UnexploredSet[agent.Direction])
+			case leaving:
+				machine.walk = agent.WalkToLastExplored(opposite)
+			case bigOut:
+				destination := [2]bhs.NodeID{agent.UnexploredSet[1] - 1, agent.UnexploredSet[0] + 1} // Left and Right destinations
+				machine.walk = agent.Walk(agent.Direction, destination[agent.Direction])
+			}
+		}
+		if !machine.walk.Next() {
+			return false
+		}
+
+		ok, updateFound := machine.walk.Result()
+		machine.walk = nil
+		switch machine.state {
+		case goingOut:
+			switch {
+			case !ok: // fell in black hole
+				search.moves += agent.Moves
+				return true
+			case updateFound:
+				machine.updated()
+			default:
+				machine.state = comingBack
+			}
+		case comingBack:
+			if updateFound {
+				machine.updated()
+				break
+			}
+			machine.remaining, machine.state = 2, leaving
+		case smallOut:
+			if !ok {
+				search.moves += agent.Moves
+				return true
+			}
+			machine.state = smallHome
+		case smallHome:
+			machine.remaining--
+			machine.state = leaving
+		case leaving:
+			agent.LeaveUpdate(machine.remaining) // right where the walk ended, without moving
+			switch machine.remaining {
+			case 2: // after phase one
+				agent.ActAsSmall = true
+				machine.small(2)
+			case 1:
+				machine.small(1)
+			case 0:
+				machine.big()
+			}
+		case bigOut:
+			switch {
+			case !ok:
+				search.moves += agent.Moves
+				return true
+			case updateFound:
+				machine.updated()
+			default: // all but one of the unexplored nodes explored, the last one is the black hole
+				machine.state = reporting
+			}
+		case reporting:
+			search.moves += agent.Moves
+			if !search.found {
+				search.found, search.blackHole = true, agent.UnexploredSet[0]
+			}
+			return true
+		}
+	}
+}
+
+// small starts iterating as small, unless the black hole is all that's left
+func (machine *optTeamSizeAgent) small(remainingIterationsAsSmall uint8) {
+	machine.remaining, machine.state = remainingIterationsAsSmall, smallOut
+	if machine.agent.UnexploredSet[0] == machine.agent.UnexploredSet[1] {
+		machine.state = reporting
+	}
+}
+
+// big starts acting as big, unless the black hole is all that's left
+func (machine *optTeamSizeAgent) big() {
+	machine.state = bigOut
+	if machine.agent.UnexploredSet[0] == machine.agent.UnexploredSet[1] {
+		machine.state = reporting
+	}
+}
+
+// updated acts on an update just found, it tells the agent whether to be small or big
+func (machine *optTeamSizeAgent) updated() {
+	if machine.agent.ActAsSmall {
+		machine.small(2)
+		return
+	}
+	machine.big()
 }
@@ -1,54 +1,121 @@
 package algorithms
 
-import (
-	"../../bhs"
-	"../../helpers"
-)
+import "../../bhs"
 
-// OptTime is a black hole search algorithm that uses 2(n-1) agents
-func OptTime(ring bhs.Ring) (bhs.NodeID, uint64, uint64) {
+// OptTime is a black hole search algorithm that uses n agents
+func OptTime(ring bhs.Ring, scheduler bhs.Scheduler) bhs.Result {
 	const cautiousWalk = false
-	ringSize := bhs.NodeID(len(ring))     // logically wrong, but needed for type correctness
-	blackHole := make(chan bhs.NodeID, 1) // channel to send the index, buffered to one
-	agentMoves := make(chan uint64, 2)    // to keep track of the number of moves and therefore time of each agent
+	team := bhs.NewTeam()
+	ringSize := bhs.NodeID(ring.Size())       // logically wrong, but needed for type correctness
+	blackHole := make(chan bhs.NodeID, 1)     // channel to send the index, buffered to one
+	idealTime := make(chan uint64, 1)         // time at which the agent that found the black hole is back home
+	agentMoves := make(chan uint64, ringSize) // to keep track of the number of moves of each agent
 
 	for id := bhs.NodeID(1); id <= ringSize; id++ {
 		results := make(chan bool, 1) // result from the agent
 
 		// launch left agent
-		go func(id bhs.NodeID, ch chan<- bool) {
-			leftAgent := bhs.NewAgent(bhs.Left, ring, cautiousWalk)
+		leftAgent := team.NewAgent(bhs.Left, ring, cautiousWalk, scheduler)
+		team.Go(scheduler, func() {
+			defer leftAgent.Terminate()
 
 			if ok, _ := leftAgent.MoveUntil(bhs.Left, id-1); !ok { // go to the neighbour of i
-				ch <- false
+				results <- false
 				agentMoves <- leftAgent.Moves
 				return
 			}
 
 			if ok, _ := leftAgent.MoveUntil(bhs.Right, (id+1)%ringSize); !ok { // go to the other neighbour or i
-				ch <- false
+				results <- false
 				agentMoves <- leftAgent.Moves
 				return
 			}
 
 			if ok, _ := leftAgent.MoveUntil(bhs.Left, leftAgent.HomebaseNodeID); !ok {
-				ch <- false
+				results <- false
 				agentMoves <- leftAgent.Moves
 				return
 			}
 
-			ch <- true
+			results <- true
 			agentMoves <- leftAgent.Moves
-			blackHole <- id
-		}(id, results)
+			select { // only the first agent back reports, as a gray hole lets some agents through
+			case blackHole <- id:
+				idealTime <- scheduler.Time()
+			default:
+			}
+		})
 	}
+	scheduler.Start()
 
-	var moveComplexity, timeComplexity uint64
-	for i := bhs.NodeID(0); i < (ringSize - 1); i++ {
-		moves := <-agentMoves
-		moveComplexity += moves
-		timeComplexity = helpers.MaxUint64(timeComplexity, moves)
+	var moveComplexity uint64
+	for i := bhs.NodeID(0); i < ringSize; i++ { // every agent reports its moves
+		moveComplexity += bhs.Receive(team, agentMoves)
 	}
 	// wait for the black hole to be found
-	return <-blackHole, moveComplexity, timeComplexity
+	return team.Result(bhs.Receive(team, blackHole), moveComplexity, bhs.Receive(team, idealTime))
+}
+
+// OptTimeMachines is OptTime with agents written as state machines, which the engine steps on a single goroutine
+func OptTimeMachines(ring bhs.Ring, engine *bhs.Engine) bhs.Result {
+	const cautiousWalk = false
+	team := bhs.NewTeam()
+	search := &optTimeSearch{engine: engine, ringSize: bhs.NodeID(ring.Size())}
+
+	for id := bhs.NodeID(1); id <= search.ringSize; id++ {
+		agent := team.NewAgent(bhs.Left, ring, cautiousWalk, engine)
+		engine.Add(agent, &optTimeAgent{agent, search, id, nil, 0})
+	}
+	engine.Start()
+
+	return team.Result(search.blackHole, search.moves, search.idealTime)
+}
+
+// optTimeSearch is what the agents of OptTime share as state machines
+type optTimeSearch struct {
+	engine    *bhs.Engine
+	ringSize  bhs.NodeID
+	moves     uint64
+	found     bool // once the first agent is back home, only it reports as a gray hole lets some agents through
+	blackHole bhs.NodeID
+	idealTime uint64
+}
+
+// optTimeAgent explores both neighbours of its node, then goes back home to report it as the black hole
+type optTimeAgent struct {
+	agent  *bhs.Agent
+	search *optTimeSearch
+	id     bhs.NodeID
+	walk   *bhs.Walk // in progress, nil between walks
+	walked int       // walks over so far: to the neighbour of i, to the other one, then back home
+}
+
+func (machine *optTimeAgent) Step() bool {
+	agent, search := machine.agent, machine.search
+	for {
+		if machine.walk == nil {
+			switch machine.walked {
+			case 0:
+				machine.walk = agent.Walk(bhs.Left, machine.id-1)
+			case 1:
+				machine.walk = agent.Walk(bhs.Right, (machine.id+1)%search.ringSize)
+			default:
+				machine.walk = agent.Walk(bhs.Left, agent.HomebaseNodeID)
+			}
+		}
+		if !machine.walk.Next() {
+			return false
+		}
+
+		ok, _ := machine.walk.Result()
+		machine.walk = nil
+		machine.walked++
+		if !ok || machine.walked == 3 {
+			search.moves += agent.Moves
+			if ok && !search.found {
+				search.found, search.blackHole, search.idealTime = true, machine.id, search.engine.Time()
+			}
+			return true
+		}
+	}
 }
@@ -0,0 +1,121 @@
+package algorithms
+
+import (
+	"context"
+	"fmt"
+
+	"../../bhs"
+)
+
+// Papers the algorithms come from, as listed in the README
+const (
+	timeOptimal     = "Balamohan, Flocchini, Miri and Santoro. Time optimal algorithms for black hole search in rings (2011)"
+	anonymousRing   = "Dobrev, Flocchini, Prencipe and Santoro. Mobile search for a black hole in an anonymous ring (2007)"
+	notFromAnyPaper = ""
+)
+
+// Model is what an algorithm needs from the ring and its agents
+type Model struct {
+	Whiteboard   bool // a whiteboard on every node
+	Tokens       bool // a pile of tokens on every node
+	CautiousWalk bool // agents label the links they explore
+	Independent  bool // agents never wait for one another, so they may run one after the other with a SequentialScheduler
+}
+
+// BuildRing creates a ring with a black hole that provides what the model needs, on top of the given options
+func (model Model) BuildRing(blackHoleID bhs.NodeID, ringSize uint64, options ...bhs.RingOption) bhs.Ring {
+	if model.Tokens {
+		options = append(append([]bhs.RingOption{}, options...), bhs.WithTokens())
+	}
+	return bhs.BuildRing(blackHoleID, ringSize, model.Whiteboard, options...)
+}
+
+// Algorithm is a black hole search algorithm looking for a single black hole, along with what it needs to run
+type Algorithm interface {
+	Name() string
+	Citation() string                                                                           // paper the algorithm comes from, empty if none
+	Model() Model                                                                               // what the algorithm needs from the ring and its agents
+	TeamSize(ringSize uint64) uint64                                                            // agents used in a ring of the given size
+	MaxLoss(ringSize uint64) uint64                                                             // agents the algorithm claims it may lose in a ring of the given size, whatever the schedule
+	MinRingSize() uint64                                                                        // smallest ring the algorithm finds the black hole of
+	Run(ring bhs.Ring, scheduler bhs.Scheduler) bhs.Result                                      // with a bhs.Engine, agents are state machines, and it panics unless Machines
+	RunContext(ctx context.Context, ring bhs.Ring, scheduler bhs.Scheduler) (bhs.Result, error) // gives up once the context is done, and fails with a bhs.Engine unless Machines
+	Machines() bool                                                                             // whether agents are also written as state machines, for a bhs.Engine to step
+}
+
+// algorithm is an Algorithm described by its fields
+type algorithm struct {
+	name        string
+	citation    string
+	model       Model
+	teamSize    func(ringSize uint64) uint64
+	maxLoss     func(ringSize uint64) uint64
+	minRingSize uint64
+	run         func(bhs.Ring, bhs.Scheduler) bhs.Result
+	machines    func(bhs.Ring, *bhs.Engine) bhs.Result // nil unless agents are also written as state machines
+}
+
+func (algorithm algorithm) Name() string                    { return algorithm.name }
+func (algorithm algorithm) Citation() string                { return algorithm.citation }
+func (algorithm algorithm) Model() Model                    { return algorithm.model }
+func (algorithm algorithm) TeamSize(ringSize uint64) uint64 { return algorithm.teamSize(ringSize) }
+func (algorithm algorithm) MaxLoss(ringSize uint64) uint64  { return algorithm.maxLoss(ringSize) }
+func (algorithm algorithm) MinRingSize() uint64             { return algorithm.minRingSize }
+func (algorithm algorithm) Machines() bool                  { return algorithm.machines != nil }
+func (algorithm algorithm) Run(ring bhs.Ring, scheduler bhs.Scheduler) bhs.Result {
+	if engine, events := scheduler.(*bhs.Engine); events {
+		if err := algorithm.steppable(scheduler); err != nil {
+			panic(err)
+		}
+		return algorithm.machines(ring, engine)
+	}
+	return algorithm.run(ring, scheduler)
+}
+func (algorithm algorithm) RunContext(ctx context.Context, ring bhs.Ring, scheduler bhs.Scheduler) (bhs.Result, error) {
+	if err := algorithm.steppable(scheduler); err != nil {
+		return bhs.Result{}, err
+	}
+	return bhs.RunContext(ctx, ring, scheduler, algorithm.Run)
+}
+
+// steppable fails for an engine given to an algorithm whose agents aren't written as state machines
+func (algorithm algorithm) steppable(scheduler bhs.Scheduler) error {
+	if _, events := scheduler.(*bhs.Engine); events && algorithm.machines == nil {
+		return fmt.Errorf("%s has no agents written as state machines for the events engine", algorithm.name)
+	}
+	return nil
+}
+
+// Team sizes, and the agents lost out of them
+func constantTeam(size uint64) func(uint64) uint64 { return func(uint64) uint64 { return size } }
+func oneAgentPerNode(ringSize uint64) uint64       { return ringSize }
+func oneAgentPerOtherNode(ringSize uint64) uint64  { return ringSize - 1 }
+func twoAgentsPerOtherNode(ringSize uint64) uint64 { return 2 * (ringSize - 1) }
+func allButOnePerOtherNode(ringSize uint64) uint64 { return ringSize - 2 } // one agent of each pair but the pair checking the black hole
+
+// registry lists the algorithms in the order the command line numbers them, new ones go last
+var registry = []Algorithm{
+	algorithm{name: "Divide", citation: anonymousRing, model: Model{Whiteboard: true, CautiousWalk: true}, teamSize: constantTeam(2), maxLoss: constantTeam(1), minRingSize: 3, run: Divide, machines: DivideMachines},
+	algorithm{name: "Group", citation: timeOptimal, model: Model{}, teamSize: oneAgentPerOtherNode, maxLoss: oneAgentPerOtherNode, minRingSize: 5, run: Group},
+	algorithm{name: "OptAvgTime", citation: timeOptimal, model: Model{Independent: true}, teamSize: twoAgentsPerOtherNode, maxLoss: allButOnePerOtherNode, minRingSize: 3, run: OptAvgTime, machines: OptAvgTimeMachines},
+	algorithm{name: "OptTeamSize", citation: timeOptimal, model: Model{Whiteboard: true, CautiousWalk: true}, teamSize: constantTeam(2), maxLoss: constantTeam(1), minRingSize: 3, run: OptTeamSize, machines: OptTeamSizeMachines},
+	algorithm{name: "OptTime", citation: anonymousRing, model: Model{Independent: true}, teamSize: oneAgentPerNode, maxLoss: oneAgentPerOtherNode, minRingSize: 3, run: OptTime, machines: OptTimeMachines},
+	algorithm{name: "TokenCount", citation: notFromAnyPaper, model: Model{Tokens: true, CautiousWalk: true}, teamSize: constantTeam(2), maxLoss: constantTeam(1), minRingSize: 3, run: TokenCount, machines: TokenCountMachines},
+	algorithm{name: "RobustTeamSize", citation: notFromAnyPaper, model: Model{Whiteboard: true}, teamSize: constantTeam(3), maxLoss: constantTeam(2), minRingSize: 3, run: RobustTeamSize},
+	algorithm{name: "UnorientedDivide", citation: anonymousRing, model: Model{Whiteboard: true, CautiousWalk: true}, teamSize: constantTeam(2), maxLoss: constantTeam(1), minRingSize: 3, run: UnorientedDivide},
+}
+
+// All returns every registered algorithm, in the order the command line numbers them
+func All() []Algorithm {
+	return append([]Algorithm{}, registry...)
+}
+
+// Lookup returns the registered algorithm with the given name
+func Lookup(name string) (Algorithm, bool) {
+	for _, algorithm := range registry {
+		if algorithm.Name() == name {
+			return algorithm, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,188 @@
+package algorithms
+
+import "../../bhs"
+
+// Marks written by RobustTeamSize
+const (
+	presenceMark  bhs.Mark = iota // 0: written by an agent on the node it stands on, so others count who arrived alive
+	rearguardMark                 // 1: written on the homebase by the rearguard when it can't tell where the gray hole is
+	leaderMark                    // 2: written on the homebase by the leader when it can't tell where the gray hole is
+)
+
+// Roles of the agents of RobustTeamSize
+const (
+	leader    = iota // 0: first to enter the next node
+	follower         // 1: joins the leader, then goes back to tell the rearguard they both made it
+	rearguard        // 2: enters the next node once told it's worth it
+)
+
+// lapRounds bounds the rounds of a lap before an agent is unsure of where the gray hole is:
+// 2 for the leader and follower to move in, 2 to check, 1 for the follower to go back, 2 to check, 1 for the follower and rearguard to move in, 2 to check
+const lapRounds = 10
+
+// robustReport is what an agent of RobustTeamSize reports once it stops, every agent reports once
+type robustReport struct {
+	role      int
+	located   bool // whether the agent tells where the gray hole is, or that none destroyed anyone in time
+	blackHole bhs.NodeID
+	moves     uint64
+}
+
+// RobustTeamSize is a black hole search algorithm that uses 3 agents, one more than OptTeamSize, and still finds gray holes
+// A gray hole may let agents through, so every arrival is watched by an agent already there: agents write a presence mark
+// on the whiteboard of the node they stand on and count them, one missing means it was destroyed arriving
+// When an agent can't tell whether the gray hole is the node the trio left or the next one, it goes to the homebase
+// without entering either, and the leader and rearguard settle it from the marks they find there
+// Relies on a synchronous scheduler, and gives up after as many laps as there are nodes, reporting node 0 if the gray hole
+// destroyed no one by then
+func RobustTeamSize(ring bhs.Ring, scheduler bhs.Scheduler) bhs.Result {
+	const cautiousWalk = false // surviving a link proves nothing, the trio watches every arrival instead
+	team := bhs.NewTeam()
+	reports := make(chan robustReport, 3)
+	ringSize := bhs.NodeID(ring.Size()) // logically wrong, but needed for type correctness)
+	laps := ringSize
+	// an unsure agent takes under a lap of moves to the homebase, and only moves and waits take rounds
+	// so the other one finds its mark there once this many rounds went by since the trio left its node
+	unsureRounds := lapRounds + ringSize
+
+	for role := leader; role <= rearguard; role++ {
+		agent := team.NewAgent(bhs.Left, ring, cautiousWalk, scheduler)
+		team.Add(1)
+		go func(agent *bhs.Agent, role int, reports chan<- robustReport) {
+			defer team.Done()
+			defer agent.Terminate()
+			report := func(located bool, blackholeID bhs.NodeID) {
+				reports <- robustReport{role, located, blackholeID, agent.Moves}
+			}
+			if agent.WriteMark(presenceMark) != nil {
+				report(false, 0)
+				return
+			}
+			var elapsed bhs.NodeID // rounds since the trio left its last node, the same for every agent
+			var present uint64     // presence marks counted on the node at the last check
+
+			// a round where the given roles move in a direction while the others wait
+			// returns false if the agent was destroyed, or couldn't carry its presence mark along
+			round := func(direction bhs.Direction, movingRoles ...int) bool {
+				elapsed++
+				for _, movingRole := range movingRoles {
+					if movingRole == role {
+						return robustMove(agent, direction) == nil
+					}
+				}
+				agent.Wait()
+				return true
+			}
+
+			// whether the agent checking its node misses some of the expected agents, between rounds where nobody moves
+			missing := func(expected uint64, checkingRoles ...int) bool {
+				round(agent.Direction) // agents that just arrived write their marks
+				checking := false
+				for _, checkingRole := range checkingRoles {
+					checking = checking || checkingRole == role
+				}
+				if checking {
+					present = agent.CountMarks(presenceMark)
+				}
+				round(agent.Direction) // agents about to leave erase their marks
+				return checking && present != expected
+			}
+
+			found := func(blackholeID bhs.NodeID) {
+				agent.MoveUntil(bhs.GetOppositeDirection(agent.Direction), 0) // go to homebase, through nodes just visited
+				report(true, blackholeID)
+			}
+
+			// goes to the homebase in a direction that enters neither the node the trio left nor the next one
+			// then waits until the other unsure agent had the time to get there, and returns whether it did
+			unsure := func(direction bhs.Direction, mark, otherMark bhs.Mark) bool {
+				start := agent.Moves
+				agent.MoveUntil(direction, 0)
+				err := agent.WriteMark(mark)
+				for elapsed += bhs.NodeID(agent.Moves - start); elapsed < unsureRounds; elapsed++ {
+					agent.Wait()
+				}
+				return err == nil && agent.CountMarks(otherMark) > 0
+			}
+
+			for advanced := bhs.NodeID(0); ; advanced, elapsed = advanced+1, 0 {
+				if advanced == laps*ringSize { // back on the homebase, a gray hole that destroyed no one so far is out of reach
+					report(true, 0)
+					return
+				}
+
+				left := agent.Location() // the whole trio stands on this node
+				next := (left + 1) % ringSize
+
+				if !round(agent.Direction, leader) || !round(agent.Direction, follower) {
+					report(false, 0)
+					return
+				}
+				if missing(2, leader, follower) { // the leader and follower check they both made it to the next node
+					found(next)
+					return
+				}
+
+				// the follower goes back, and the rearguard checks it came back
+				round(bhs.GetOppositeDirection(agent.Direction), follower)
+				if missing(2, rearguard) {
+					// the follower was destroyed arriving at the next node, or coming back
+					// only the leader knows it made it to the next node, and is then unsure as well
+					if unsure(bhs.GetOppositeDirection(agent.Direction), rearguardMark, leaderMark) {
+						found(left)
+					} else {
+						found(next)
+					}
+					return
+				}
+
+				if !round(agent.Direction, follower, rearguard) {
+					report(false, 0)
+					return
+				}
+				if missing(3, leader, follower, rearguard) { // everyone checks the 3 agents made it to the next node
+					if role != leader || present != 1 {
+						found(next)
+						return
+					}
+					// the follower was destroyed coming back so the rearguard never came, or they were both destroyed arriving
+					// the rearguard only makes it to the homebase in the first case
+					if unsure(agent.Direction, leaderMark, rearguardMark) {
+						found(left)
+					} else {
+						found(next)
+					}
+					return
+				}
+			}
+		}(agent, role, reports)
+	}
+	scheduler.Start()
+
+	var reported [3]robustReport
+	var moves uint64
+	for range reported {
+		report := bhs.Receive(team, reports)
+		reported[report.role] = report
+		moves += report.moves
+	}
+	var blackHole bhs.NodeID          // none located it if they had no whiteboards to write on
+	for _, report := range reported { // the first role to locate it, whatever the order goroutines got to report in
+		if report.located {
+			blackHole = report.blackHole
+			break
+		}
+	}
+	return team.Result(blackHole, moves, scheduler.Time())
+}
+
+// robustMove takes the agent's presence mark along to the next node
+func robustMove(agent *bhs.Agent, direction bhs.Direction) error {
+	if err := agent.EraseMark(presenceMark); err != nil {
+		return err
+	}
+	if _, err := agent.Move(direction); err != nil {
+		return err
+	}
+	return agent.WriteMark(presenceMark)
+}
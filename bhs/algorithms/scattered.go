@@ -0,0 +1,66 @@
+package algorithms
+
+import "../../bhs"
+
+// Scattered is a black hole search algorithm for agents starting from different homebases, one agent per homebase
+// Every agent cautiously walks to the left, and waits in front of links being explored by others
+// A link left active for longer than a cautious step is the one an agent fell in the black hole through
+// Relies on a synchronous scheduler to tell a dead agent from a slow one, and on an oriented ring
+// In an anonymous ring, agents count locations from their own homebase, which the result tells
+func Scattered(ring bhs.Ring, scheduler bhs.Scheduler) bhs.Result {
+	const cautiousWalk = true
+	team := bhs.NewTeam()
+	homebases := ring.Homebases()
+	blackhole := make(chan scatteredReport, len(homebases)) // every survivor reports the black hole
+	moves := make(chan uint64, len(homebases))
+	ringSize := bhs.NodeID(ring.Size()) // logically wrong, but needed for type correctness)
+
+	for _, homebase := range homebases {
+		agent := team.NewAgentAt(bhs.Left, ring, cautiousWalk, scheduler, homebase)
+		team.Add(1)
+		go func(agent *bhs.Agent, blackhole chan<- scatteredReport, moves chan<- uint64) {
+			defer team.Done()
+			defer agent.Terminate()
+
+			for waited := 0; ; {
+				_, err := agent.Move(agent.Direction)
+				if err == nil {
+					waited = 0
+					continue
+				}
+				if !agent.Active { // fell in the black hole
+					moves <- agent.Moves
+					return
+				}
+
+				// another agent is exploring the link, or died doing so
+				// a cautious step keeps the link active for 2 time units at most, and it may end as the agent looks
+				if waited == 3 {
+					break
+				}
+				agent.Wait()
+				waited++
+			}
+
+			blackhole <- scatteredReport{agent, (agent.Location() + 1) % ringSize}
+			moves <- agent.Moves
+		}(agent, blackhole, moves)
+	}
+	scheduler.Start()
+
+	var totalMoves uint64
+	for range homebases {
+		totalMoves += bhs.Receive(team, moves)
+	}
+	report := bhs.Receive(team, blackhole)
+	if report.agent == nil { // cancelled before any agent reported
+		return team.Result(0, totalMoves, scheduler.Time())
+	}
+	return team.ResultFrom(report.agent, report.blackHole, totalMoves, scheduler.Time())
+}
+
+// scatteredReport is the black hole as an agent of Scattered locates it
+type scatteredReport struct {
+	agent     *bhs.Agent
+	blackHole bhs.NodeID
+}
@@ -0,0 +1,84 @@
+package algorithms
+
+import (
+	"sort"
+
+	"../../bhs"
+)
+
+// ShadowPairs is a black hole search algorithm that uses 4 agents to find every reachable black hole
+// A pair of agents goes each way: the explorer cautiously walks until it falls in a black hole, while its shadow waits at the homebase
+// Once the explorer had the time to explore the whole ring, the shadow follows the explored links up to the one left active
+// Relies on a synchronous scheduler, as shadows tell a dead explorer from a slow one by waiting
+func ShadowPairs(ring bhs.Ring, scheduler bhs.Scheduler) ([]bhs.NodeID, bhs.Result) {
+	lastSafe, result := shadowPairs(ring, scheduler)
+	ringSize := bhs.NodeID(ring.Size()) // logically wrong, but needed for type correctness)
+
+	// both shadows find the same black hole if there is only one
+	found := map[bhs.NodeID]bool{(lastSafe[0] + 1) % ringSize: true, (lastSafe[1] + ringSize - 1) % ringSize: true}
+	var blackholes []bhs.NodeID
+	for blackhole := range found {
+		blackholes = append(blackholes, blackhole)
+	}
+	sort.Slice(blackholes, func(i, j int) bool { return blackholes[i] < blackholes[j] })
+	return blackholes, result
+}
+
+// BlackLinkPairs is a black link search algorithm that uses the same agents as ShadowPairs
+// Explorers are destroyed on each side of the black link, so shadows stop at both of its ends
+// Returns the locations of the two ends of the black link, the left one first
+func BlackLinkPairs(ring bhs.Ring, scheduler bhs.Scheduler) ([2]bhs.NodeID, bhs.Result) {
+	return shadowPairs(ring, scheduler)
+}
+
+// shadowPairs sends an explorer and its shadow each way
+// Returns the locations where the left and right shadows stopped, in front of the link their explorer left active
+// The result doesn't tell a black hole, as there may be two
+func shadowPairs(ring bhs.Ring, scheduler bhs.Scheduler) ([2]bhs.NodeID, bhs.Result) {
+	const cautiousWalk = true
+	team := bhs.NewTeam()
+	lastSafe := [2]chan bhs.NodeID{make(chan bhs.NodeID, 1), make(chan bhs.NodeID, 1)}
+	moves := make(chan uint64, 4)
+	ringSize := bhs.NodeID(ring.Size()) // logically wrong, but needed for type correctness)
+
+	directions := [2]bhs.Direction{bhs.Left, bhs.Right}
+	for i := 0; i < len(directions); i++ {
+		explorer := team.NewAgent(directions[i], ring, cautiousWalk, scheduler)
+		team.Add(1)
+		go func(explorer *bhs.Agent, moves chan<- uint64) {
+			defer team.Done()
+			defer explorer.Terminate()
+			for {
+				if _, err := explorer.Move(explorer.Direction); err != nil { // destroyed
+					moves <- explorer.Moves
+					return
+				}
+			}
+		}(explorer, moves)
+
+		shadow := team.NewAgent(directions[i], ring, cautiousWalk, scheduler)
+		team.Add(1)
+		go func(shadow *bhs.Agent, lastSafe chan<- bhs.NodeID, moves chan<- uint64) {
+			defer team.Done()
+			defer shadow.Terminate()
+			for i := bhs.NodeID(0); i < 3*ringSize; i++ { // a cautious step takes at most 3 time units
+				shadow.Wait()
+			}
+
+			for { // stops in front of the active link, as no other agent is left on this side
+				if _, err := shadow.Move(shadow.Direction); err != nil {
+					break
+				}
+			}
+			lastSafe <- shadow.Location()
+			moves <- shadow.Moves
+		}(shadow, lastSafe[i], moves)
+	}
+	scheduler.Start()
+
+	var totalMoves uint64
+	for i := 0; i < 4; i++ {
+		totalMoves += bhs.Receive(team, moves)
+	}
+	return [2]bhs.NodeID{bhs.Receive(team, lastSafe[0]), bhs.Receive(team, lastSafe[1])}, team.Result(0, totalMoves, scheduler.Time())
+}
@@ -0,0 +1,125 @@
+package algorithms
+
+import "../../bhs"
+
+// Tokens counting the nodes explored on each side of the homebase
+const (
+	leftCountToken  bhs.TokenColor = iota + 2 // 2: one per node explored left of the homebase
+	rightCountToken                           // 3: one per node explored right of the homebase
+)
+
+// TokenCount is a black hole search algorithm that uses 2 agents and tokens instead of whiteboards
+// Each agent explores one more node on its side, then reports it by dropping a token on the homebase
+func TokenCount(ring bhs.Ring, scheduler bhs.Scheduler) bhs.Result {
+	const cautiousWalk = true
+	team := bhs.NewTeam()
+	blackhole := make(chan bhs.NodeID, 2) // both agents may see the last unexplored node
+	moves := make(chan uint64, 2)
+	ringSize := bhs.NodeID(ring.Size()) // logically wrong, but needed for type correctness)
+
+	directions := [2]bhs.Direction{bhs.Left, bhs.Right}
+	for i := 0; i < len(directions); i++ {
+		agent := team.NewAgent(directions[i], ring, cautiousWalk, scheduler)
+		team.Add(1)
+		go func(agent *bhs.Agent, blackhole chan<- bhs.NodeID, moves chan<- uint64) {
+			defer team.Done()
+			defer agent.Terminate()
+			countToken, frontier := leftCountToken, 0
+			if agent.Direction == bhs.Right {
+				countToken, frontier = rightCountToken, 1
+			}
+
+			for {
+				// read the tokens on the homebase to know what is left to explore
+				agent.UnexploredSet = [2]bhs.NodeID{bhs.NodeID(agent.CountTokens(leftCountToken)) + 1, ringSize - 1 - bhs.NodeID(agent.CountTokens(rightCountToken))}
+				if agent.UnexploredSet[0] == agent.UnexploredSet[1] {
+					break
+				}
+
+				if ok, _ := agent.MoveUntil(agent.Direction, agent.UnexploredSet[frontier]); !ok {
+					moves <- agent.Moves
+					return
+				}
+				agent.MoveUntil(bhs.GetOppositeDirection(agent.Direction), 0) // go to homebase
+				agent.DropToken(countToken)
+			}
+
+			blackhole <- agent.UnexploredSet[0]
+			moves <- agent.Moves
+		}(agent, blackhole, moves)
+	}
+	scheduler.Start()
+
+	movesAgent1, movesAgent2 := bhs.Receive(team, moves), bhs.Receive(team, moves)
+	return team.Result(bhs.Receive(team, blackhole), movesAgent1+movesAgent2, scheduler.Time())
+}
+
+// TokenCountMachines is TokenCount with agents written as state machines, which the engine steps on a single goroutine
+func TokenCountMachines(ring bhs.Ring, engine *bhs.Engine) bhs.Result {
+	const cautiousWalk = true
+	team := bhs.NewTeam()
+	search := &tokenCountSearch{ringSize: bhs.NodeID(ring.Size())} // logically wrong, but needed for type correctness)
+
+	directions := [2]bhs.Direction{bhs.Left, bhs.Right}
+	for i := 0; i < len(directions); i++ {
+		agent := team.NewAgent(directions[i], ring, cautiousWalk, engine)
+		machine := &tokenCountAgent{agent, search, leftCountToken, 0, nil, false}
+		if agent.Direction == bhs.Right {
+			machine.countToken, machine.frontier = rightCountToken, 1
+		}
+		engine.Add(agent, machine)
+	}
+	engine.Start()
+
+	return team.Result(search.blackHole, search.moves, engine.Time())
+}
+
+// tokenCountSearch is what the agents of TokenCount share as state machines
+type tokenCountSearch struct {
+	ringSize  bhs.NodeID
+	moves     uint64
+	found     bool // both agents may see the last unexplored node
+	blackHole bhs.NodeID
+}
+
+// tokenCountAgent explores one more node at a time, and reports it with a token on the homebase
+type tokenCountAgent struct {
+	agent      *bhs.Agent
+	search     *tokenCountSearch
+	countToken bhs.TokenColor
+	frontier   int       // end of the unexplored set on the agent's side
+	walk       *bhs.Walk // in progress, nil between walks
+	returning  bool      // whether the walk goes to the homebase, rather than to the frontier
+}
+
+func (machine *tokenCountAgent) Step() bool {
+	agent, search := machine.agent, machine.search
+	for {
+		if machine.walk == nil {
+			// read the tokens on the homebase to know what is left to explore
+			agent.UnexploredSet = [2]bhs.NodeID{bhs.NodeID(agent.CountTokens(leftCountToken)) + 1, search.ringSize - 1 - bhs.NodeID(agent.CountTokens(rightCountToken))}
+			if agent.UnexploredSet[0] == agent.UnexploredSet[1] {
+				search.moves += agent.Moves
+				if !search.found {
+					search.found, search.blackHole = true, agent.UnexploredSet[0]
+				}
+				return true
+			}
+			machine.walk = agent.Walk(agent.Direction, agent.UnexploredSet[machine.frontier])
+		}
+		if !machine.walk.Next() {
+			return false
+		}
+
+		if machine.returning {
+			agent.DropToken(machine.countToken)
+			machine.walk, machine.returning = nil, false
+			continue
+		}
+		if ok, _ := machine.walk.Result(); !ok {
+			search.moves += agent.Moves
+			return true
+		}
+		machine.walk, machine.returning = agent.Walk(bhs.GetOppositeDirection(agent.Direction), 0), true // go to homebase
+	}
+}
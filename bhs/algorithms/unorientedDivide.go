@@ -0,0 +1,97 @@
+package algorithms
+
+import "../../bhs"
+
+// UnorientedDivide is Divide for agents that only go by the local ports of each node, with no common sense of direction
+// Each agent leaves the homebase through a port of its own, and learns which half of the ring it explores from where it lands
+func UnorientedDivide(ring bhs.Ring, scheduler bhs.Scheduler) bhs.Result {
+	const cautiousWalk = true
+	team := bhs.NewTeam()
+	blackhole := make(chan bhs.NodeID, 2) // both agents may survive and report the black hole
+	moves := make(chan uint64, 2)
+	ringSize := bhs.NodeID(ring.Size()) // logically wrong, but needed for type correctness)
+
+	for port := bhs.Direction(0); port < 2; port++ {
+		agent := team.NewAgent(port, ring, cautiousWalk, scheduler) // its direction only tells the agents apart on whiteboards
+		team.Add(1)
+		go func(agent *bhs.Agent, walker *portWalker, blackhole chan<- bhs.NodeID, moves chan<- uint64) {
+			defer team.Done()
+			defer agent.Terminate()
+			agent.ActAsSmall = false // for update catching
+			agent.UnexploredSet = [2]bhs.NodeID{1, ringSize - 1}
+			homebase := agent.Location()
+
+			// every destination is at least a node away, so the agent heads for the first one before it knows which half of the ring it explores
+			unexploredSet, updated := agent.UnexploredSet, false
+			for agent.Location() == homebase { // the move may stop before leaving, on an update
+				updateFound, err := walker.move(true)
+				if err != nil {
+					moves <- agent.Moves
+					return
+				}
+				updated = updated || updateFound
+			}
+			side := bhs.Left // the half Divide's left agent explores, where locations go up
+			if agent.Location() != (homebase+1)%ringSize {
+				side = bhs.Right
+			}
+			if updated {
+				unexploredSet = agent.UnexploredSet
+			}
+
+			for destination := equallyDivideUnexploredSet(side, unexploredSet); agent.UnexploredSet[0] != agent.UnexploredSet[1]; destination = equallyDivideUnexploredSet(side, agent.UnexploredSet) {
+				ok, updateFound := walker.until(true, destination)
+				if !ok {
+					moves <- agent.Moves
+					return
+				}
+
+				if !updateFound && agent.UnexploredSet[0] != agent.UnexploredSet[1] { // if other agent falls in the black hole, update useless
+					walker.ahead = agent.LeaveUpdateDivideThrough(bhs.GetOppositeDirection(walker.ahead))
+				}
+			}
+
+			walker.until(false, homebase)
+			blackhole <- agent.UnexploredSet[0]
+			moves <- agent.Moves
+		}(agent, &portWalker{agent, port}, blackhole, moves)
+	}
+	scheduler.Start()
+
+	movesAgent1, movesAgent2 := bhs.Receive(team, moves), bhs.Receive(team, moves)
+	return team.Result(bhs.Receive(team, blackhole), movesAgent1+movesAgent2, scheduler.Time())
+}
+
+// portWalker keeps an agent going one way around the ring from the ports it arrives through, as it can't tell left from right
+type portWalker struct {
+	agent *bhs.Agent
+	ahead bhs.Direction // port of the current node leading on the way the agent goes
+}
+
+// move moves the agent through the port ahead, or the one leading back, then finds the port ahead on the node it ends on
+func (walker *portWalker) move(forward bool) (updateFound bool, err error) {
+	agent, location := walker.agent, walker.agent.Location()
+	port := walker.ahead
+	if !forward {
+		port = bhs.GetOppositeDirection(port)
+	}
+	updateFound, err = agent.MoveThrough(port)
+	if agent.Location() != location { // the move may stop before leaving, on an update
+		walker.ahead = agent.Arrival()
+		if forward {
+			walker.ahead = bhs.GetOppositeDirection(walker.ahead)
+		}
+	}
+	return updateFound, err
+}
+
+// until moves the agent ahead, or back, until it reaches a location, returns whether it made it alive and whether it stopped on an update, as MoveUntil does
+func (walker *portWalker) until(forward bool, location bhs.NodeID) (bool, bool) {
+	for walker.agent.Location() != location {
+		updateFound, err := walker.move(forward)
+		if err != nil || updateFound {
+			return err == nil, updateFound
+		}
+	}
+	return true, false
+}
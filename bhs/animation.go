@@ -0,0 +1,152 @@
+package bhs
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// animationWidth is the number of nodes drawn on each line of a frame
+const animationWidth = 40
+
+// animatedAgent is what the animation knows of an agent
+type animatedAgent struct {
+	node      NodeID
+	direction Direction // of its last move around the ring, None before it moved
+	alive     bool
+}
+
+// Animation draws the ring in a terminal as the search goes, a frame per time unit of the scheduler
+// Nodes are drawn left to right in increasing IDs, wrapped every 40 nodes, and links are coloured by their cautious walk label
+// Under each node are the number of agents on it and where they head: > towards the next node, < towards the previous one
+// The scheduler waits for a frame to be drawn before going on, so the search runs at the pace of the animation
+type Animation struct {
+	sync.Mutex
+	writer    io.Writer
+	frame     time.Duration
+	ringSize  NodeID
+	time      uint64
+	agents    map[uint64]*animatedAgent
+	labels    map[directedLink]ExploredType // labels of the ports of each node, by their direction around the ring
+	destroyed map[NodeID]bool               // nodes agents were destroyed on
+	found     NodeID
+	hasFound  bool
+}
+
+// NewAnimation helps construct an animation of a ring of the given size, waiting for the given duration after every frame
+func NewAnimation(writer io.Writer, ringSize uint64, frame time.Duration) *Animation {
+	return &Animation{writer: writer, frame: frame, ringSize: NodeID(ringSize), agents: make(map[uint64]*animatedAgent), labels: make(map[directedLink]ExploredType), destroyed: make(map[NodeID]bool)}
+}
+
+// Trace draws a frame once the scheduler's time moves on, then keeps track of the event
+func (animation *Animation) Trace(event Event) {
+	animation.Lock()
+	defer animation.Unlock()
+
+	if event.Time > animation.time {
+		animation.draw()
+		time.Sleep(animation.frame)
+		animation.time = event.Time
+	}
+
+	switch event.Kind {
+	case AgentSpawned:
+		animation.agents[event.Agent] = &animatedAgent{event.Node, None, true}
+	case AgentMoved:
+		animation.agents[event.Agent].node, animation.agents[event.Agent].direction = event.To, event.Direction
+	case LabelChanged:
+		animation.labels[directedLink{event.Node, event.Direction}] = event.Label
+	case AgentDestroyed:
+		animation.agents[event.Agent].alive = false
+		animation.destroyed[event.Node] = true
+	}
+}
+
+// Found marks the node the search reported as the black hole, for the next frames
+func (animation *Animation) Found(blackHole NodeID) {
+	animation.Lock()
+	defer animation.Unlock()
+	animation.found, animation.hasFound = blackHole, true
+}
+
+// Draw draws a frame of the current state, e.g. the last one once the search is over
+func (animation *Animation) Draw() {
+	animation.Lock()
+	defer animation.Unlock()
+	animation.draw()
+}
+
+// draw clears the terminal and draws a frame, must be called with the lock held
+func (animation *Animation) draw() {
+	var frame strings.Builder
+	frame.WriteString("\033[H\033[2J") // move to the top left corner and clear the screen
+
+	var alive, destroyed int
+	counts := make(map[NodeID]int)
+	directions := make(map[NodeID]Direction)
+	for _, agent := range animation.agents {
+		if !agent.alive {
+			destroyed++
+			continue
+		}
+		alive++
+		if counts[agent.node]++; counts[agent.node] == 1 {
+			directions[agent.node] = agent.direction
+		} else if directions[agent.node] != agent.direction {
+			directions[agent.node] = None // heading both ways
+		}
+	}
+	fmt.Fprintf(&frame, "time %d\t agents %d\t destroyed %d\n\n", animation.time, alive, destroyed)
+
+	for start := NodeID(0); start < animation.ringSize; start += animationWidth {
+		var nodes, agents, headings strings.Builder
+		for id := start; id < start+animationWidth && id < animation.ringSize; id++ {
+			nodes.WriteString(animation.node(id))
+			nodes.WriteString(animation.link(id))
+
+			count, heading := " ", " "
+			switch {
+			case counts[id] > 9:
+				count = "+"
+			case counts[id] > 0:
+				count = fmt.Sprint(counts[id])
+			}
+			if counts[id] > 0 {
+				heading = map[Direction]string{Left: ">", Right: "<", None: "*"}[directions[id]]
+			}
+			agents.WriteString(count + " ")
+			headings.WriteString(heading + " ")
+		}
+		fmt.Fprintf(&frame, "%4d %s\n     %s\n     %s\n\n", start, nodes.String(), agents.String(), headings.String())
+	}
+	fmt.Fprint(&frame, "o node  x agent destroyed  B black hole found  - unexplored  = active  - explored (green)\n")
+	fmt.Fprint(animation.writer, frame.String())
+}
+
+// node draws a node: where an agent was destroyed, the black hole found, or a plain node
+func (animation *Animation) node(id NodeID) string {
+	switch {
+	case animation.hasFound && id == animation.found:
+		return color.New(color.FgRed, color.Bold, color.ReverseVideo).Sprint("B")
+	case animation.destroyed[id]:
+		return color.New(color.FgRed, color.Bold).Sprint("x")
+	}
+	return "o"
+}
+
+// link draws the link from a node to the next one, coloured by the labels at its ends
+func (animation *Animation) link(id NodeID) string {
+	next := (id + 1) % animation.ringSize
+	labels := [2]ExploredType{animation.labels[directedLink{id, Left}], animation.labels[directedLink{next, Right}]}
+	switch {
+	case labels[0] == active || labels[1] == active:
+		return color.New(color.FgYellow, color.Bold).Sprint("=")
+	case labels[0] == explored || labels[1] == explored:
+		return color.New(color.FgGreen).Sprint("-")
+	}
+	return color.New(color.FgHiBlack).Sprint("-")
+}
@@ -0,0 +1,153 @@
+package bhs
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Invariant is a rule of the cautious walk protocol the algorithms rely on
+type Invariant uint8
+
+// Invariants checked by a Checker
+const (
+	OneDeathPerActiveLink     Invariant = iota // 0: at most one agent ever dies through a link labelled active
+	NoCrossingActiveLink                       // 1: no agent crosses a link another agent labelled active, to the node beyond it
+	UnexploredSetHasBlackHole                  // 2: the unexplored set of every update written or read contains a black hole
+)
+
+var invariants = [...]string{"at most one agent dies through an active link", "no agent crosses a link another agent left active", "the unexplored set of every update contains the black hole"}
+
+func (invariant Invariant) String() string {
+	if int(invariant) < len(invariants) {
+		return invariants[invariant]
+	}
+	return "unknown"
+}
+
+// Violation is an event that broke an invariant
+type Violation struct {
+	Invariant Invariant
+	Event     Event
+}
+
+func (violation Violation) Error() string {
+	event := violation.Event
+	return fmt.Sprintf("invariant violated: %s, by agent %d %s on node %d at time %d (event %d)", violation.Invariant, event.Agent, event.Kind, event.Node, event.Time, event.Sequence)
+}
+
+// Checker is a tracer checking the invariants of cautious walk against the events and the ring they happen on
+// Tokens leave no trace, so only cautious walks with whiteboards are checked
+// It follows one ring at a time, building another ring with it starts over while keeping the violations found so far
+type Checker struct {
+	sync.Mutex
+	onViolation func(violation Violation)
+	ring        Ring
+	homebases   map[uint64]NodeID       // of each agent, anonymous agents count locations from there
+	active      map[directedLink]uint64 // links labelled active at the end they were left from, with the agent that did
+	crossed     map[uint64]directedLink // link each agent crossed last
+	wasActive   map[uint64]bool         // whether that link was labelled active as the agent crossed it
+	deaths      map[directedLink]int    // agents destroyed through each link while it was labelled active
+	violations  []Violation
+}
+
+// NewChecker helps construct a checker, which calls onViolation as soon as an invariant is broken
+// onViolation is called by the agent that broke it, a nil one panics there instead
+func NewChecker(onViolation func(violation Violation)) *Checker {
+	checker := &Checker{onViolation: onViolation}
+	checker.follow(Ring{})
+	return checker
+}
+
+// follow starts checking the events of a new ring
+func (checker *Checker) follow(ring Ring) {
+	checker.Lock()
+	defer checker.Unlock()
+	checker.ring = ring
+	checker.homebases = make(map[uint64]NodeID)
+	checker.active = make(map[directedLink]uint64)
+	checker.crossed = make(map[uint64]directedLink)
+	checker.wasActive = make(map[uint64]bool)
+	checker.deaths = make(map[directedLink]int)
+}
+
+// Trace checks the event against the invariants, and keeps track of the labels and crossings they depend on
+func (checker *Checker) Trace(event Event) {
+	checker.Lock()
+	var violated []Violation
+	defer func() { // onViolation may well stop the run, so it is called once the checker is unlocked
+		checker.violations = append(checker.violations, violated...)
+		checker.Unlock()
+		for _, violation := range violated {
+			if checker.onViolation == nil {
+				panic(violation)
+			}
+			checker.onViolation(violation)
+		}
+	}()
+
+	switch event.Kind {
+	case AgentSpawned:
+		checker.homebases[event.Agent] = event.Node
+	case LabelChanged:
+		link := directedLink{event.Node, event.Direction}
+		if event.Label == active {
+			checker.active[link] = event.Agent
+		} else {
+			delete(checker.active, link)
+		}
+	case AgentMoved:
+		link := directedLink{event.Node, event.Direction}
+		labeller, isActive := checker.active[link]
+		if isActive && labeller != event.Agent {
+			violated = append(violated, Violation{NoCrossingActiveLink, event})
+		}
+		checker.crossed[event.Agent], checker.wasActive[event.Agent] = link, isActive
+	case AgentDestroyed:
+		link, isActive := checker.crossed[event.Agent], checker.wasActive[event.Agent]
+		if event.To != event.Node { // destroyed by a black link, which it didn't get to the end of
+			link = directedLink{event.Node, event.Direction}
+			_, isActive = checker.active[link]
+		}
+		if isActive {
+			if checker.deaths[link]++; checker.deaths[link] > 1 {
+				violated = append(violated, Violation{OneDeathPerActiveLink, event})
+			}
+		}
+	case UpdateWritten, UpdateRead:
+		if !checker.hasBlackHole(event.Agent, event.Unexplored) {
+			violated = append(violated, Violation{UnexploredSetHasBlackHole, event})
+		}
+	}
+}
+
+// hasBlackHole returns whether a set of nodes, as the agent counts them, contains a black or gray hole
+// Rings without any, e.g. with a black link instead, have nothing to check
+func (checker *Checker) hasBlackHole(agent uint64, unexplored [2]NodeID) bool {
+	ring, holes := checker.ring, 0
+	for _, node := range ring.allocated() { // holes always are
+		if node.BlackHole || node.grayHole != nil {
+			holes++
+		}
+	}
+	if holes == 0 {
+		return true
+	}
+
+	for offset := NodeID(0); offset <= (unexplored[1]+ring.size-unexplored[0])%ring.size; offset++ { // the set may wrap around node 0
+		id := (unexplored[0] + offset) % ring.size
+		if ring.anonymous {
+			id = ring.NodeAt(checker.homebases[agent], id)
+		}
+		if node := ring.lookup(id); node != nil && (node.BlackHole || node.grayHole != nil) {
+			return true
+		}
+	}
+	return false
+}
+
+// Violations returns the violations found so far, in the order they happened
+func (checker *Checker) Violations() []Violation {
+	checker.Lock()
+	defer checker.Unlock()
+	return append([]Violation{}, checker.violations...)
+}
@@ -0,0 +1,81 @@
+package bhs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// chromeTimeUnit is how many microseconds of the trace a time unit of the scheduler lasts
+const chromeTimeUnit = 1000
+
+// chromeEvent is an event of the Chrome trace event format
+type chromeEvent struct {
+	Name      string                 `json:"name"`
+	Phase     string                 `json:"ph"` // B and E begin and end a span, i is an instant, M names a track
+	Timestamp uint64                 `json:"ts"` // microseconds
+	Process   int                    `json:"pid"`
+	Thread    uint64                 `json:"tid"`
+	Scope     string                 `json:"s,omitempty"` // t keeps instants on their track
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// ChromeTracer collects events in the Chrome trace event format, which Perfetto and chrome://tracing open
+// Each agent is a track, each walk of MoveUntil is a span, and whiteboard updates, deaths and terminations are instants
+// A time unit of the scheduler lasts a millisecond of the trace
+type ChromeTracer struct {
+	sync.Mutex
+	events []chromeEvent
+}
+
+// NewChromeTracer helps construct a tracer collecting Chrome trace events
+func NewChromeTracer() *ChromeTracer {
+	return &ChromeTracer{}
+}
+
+// Trace collects the events that show in Chrome traces, the others are dropped
+func (tracer *ChromeTracer) Trace(event Event) {
+	tracer.Lock()
+	defer tracer.Unlock()
+
+	at := func(phase string, name string, args map[string]interface{}) {
+		scope := ""
+		if phase == "i" {
+			scope = "t"
+		}
+		tracer.events = append(tracer.events, chromeEvent{name, phase, event.Time * chromeTimeUnit, 1, event.Agent, scope, args})
+	}
+	switch event.Kind {
+	case AgentSpawned:
+		at("M", "thread_name", map[string]interface{}{"name": fmt.Sprintf("agent %d", event.Agent)})
+	case WalkStarted:
+		at("B", fmt.Sprintf("walk %s to %d", map[Direction]string{Left: "left", Right: "right"}[event.Direction], event.To), map[string]interface{}{"from": event.Node, "seq": event.Sequence})
+	case WalkEnded:
+		at("E", "", map[string]interface{}{"at": event.Node})
+	case UpdateWritten:
+		at("i", "update written", map[string]interface{}{"node": event.Node, "seq": event.Sequence})
+	case UpdateRead:
+		at("i", "update read", map[string]interface{}{"node": event.Node, "seq": event.Sequence})
+	case AgentDestroyed:
+		at("i", "destroyed", map[string]interface{}{"node": event.Node, "seq": event.Sequence})
+	case AgentTerminated:
+		at("i", "terminated", map[string]interface{}{"node": event.Node, "seq": event.Sequence})
+	}
+}
+
+// WriteTo writes the events collected so far as a Chrome trace
+func (tracer *ChromeTracer) WriteTo(writer io.Writer) (int64, error) {
+	tracer.Lock()
+	trace, err := json.Marshal(struct {
+		TraceEvents     []chromeEvent `json:"traceEvents"`
+		DisplayTimeUnit string        `json:"displayTimeUnit"`
+	}{append([]chromeEvent{}, tracer.events...), "ms"})
+	tracer.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := writer.Write(trace)
+	return int64(written), err
+}
@@ -0,0 +1,182 @@
+package bhs
+
+import (
+	"sort"
+	"sync"
+)
+
+// compactShards is the number of parts the nodes allocated so far are split in, by ID, each with its own lock
+// Neighbouring nodes fall in different parts, so agents looking up nodes around them seldom wait for one another
+const compactShards = 64
+
+// compactShard is a part of the nodes allocated so far
+type compactShard struct {
+	sync.Mutex
+	nodes map[NodeID]*Node // nil until the first node of the part is allocated
+}
+
+// compactNodes are the nodes of a ring allocated so far, rings are built this way before allocating every node
+// A compact ring stays this way: its nodes are only allocated once an agent needs their whiteboard or tokens
+type compactNodes struct {
+	shards      [compactShards]compactShard
+	whiteboards bool // whether nodes come with a whiteboard
+	tokens      bool // whether nodes come with a pile of tokens
+	kept        bool // whether the ring stays compact once built
+}
+
+// shard returns the part the node with the given ID is in
+func (compact *compactNodes) shard(id NodeID) *compactShard {
+	return &compact.shards[id%compactShards]
+}
+
+// Compact keeps the nodes of the ring implicit: only holes and nodes whose whiteboard or tokens agents use are allocated
+// Agents of algorithms using neither move around a ring of millions of nodes without allocating anything
+func Compact() RingOption {
+	return func(ring *Ring) {
+		ring.compact.kept = true
+	}
+}
+
+// node returns the node with the given ID, allocating it on first use
+func (compact *compactNodes) node(id NodeID) *Node {
+	shard := compact.shard(id)
+	shard.Lock()
+	defer shard.Unlock()
+	node, allocated := shard.nodes[id]
+	if !allocated {
+		if shard.nodes == nil {
+			shard.nodes = make(map[NodeID]*Node)
+		}
+		node = compact.newNode(id)
+		shard.nodes[id] = node
+	}
+	return node
+}
+
+// newNode creates a node with what nodes of the ring come with
+func (compact *compactNodes) newNode(id NodeID) *Node {
+	node := &Node{false, id, nil, nil, nil}
+	if compact.whiteboards {
+		node.whiteboard = newWhiteboard(2)
+	}
+	if compact.tokens {
+		node.tokens = newTokens()
+	}
+	return node
+}
+
+// expand allocates every node of a ring of the given size, starting from the ones allocated so far
+func (compact *compactNodes) expand(ringSize NodeID) []*Node {
+	nodes := make([]*Node, 0, ringSize)
+	for id := NodeID(0); id < ringSize; id++ {
+		node, allocated := compact.shard(id).nodes[id]
+		if !allocated {
+			node = compact.newNode(id)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// lookup returns the node with the given ID if it was allocated, every node of a ring that isn't compact is
+func (ring Ring) lookup(id NodeID) *Node {
+	if ring.compact == nil {
+		return ring.nodes[id]
+	}
+	shard := ring.compact.shard(id)
+	shard.Lock()
+	defer shard.Unlock()
+	return shard.nodes[id]
+}
+
+// allocated returns the nodes allocated so far in increasing IDs, every node of a ring that isn't compact
+func (ring Ring) allocated() []*Node {
+	if ring.compact == nil {
+		return ring.nodes
+	}
+	var nodes []*Node
+	for index := range ring.compact.shards {
+		shard := &ring.compact.shards[index]
+		shard.Lock()
+		for _, node := range shard.nodes {
+			nodes = append(nodes, node)
+		}
+		shard.Unlock()
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// IsCompact returns whether the nodes of the ring are only allocated once agents need them
+func (ring Ring) IsCompact() bool {
+	return ring.compact != nil
+}
+
+// peek returns the node with the given ID without allocating it, nil for a node of a compact ring that wasn't
+func peek(topology Topology, id NodeID) *Node {
+	if ring, onRing := topology.(Ring); onRing {
+		return ring.lookup(id)
+	}
+	return topology.Node(id)
+}
+
+// scratchNode is the node an agent stands on in a compact ring while it isn't allocated, with the whiteboard and tokens such a node has
+type scratchNode struct {
+	node       Node
+	whiteboard Whiteboard
+	label      [2]ExploredType
+	tokens     Tokens
+}
+
+// nodeAt returns the node with the given ID for the agent to stand on
+// On a compact ring, a node without holes that no agent wrote on is the agent's own scratch node, with a blank whiteboard and no tokens
+func (agent *Agent) nodeAt(id NodeID) *Node {
+	ring, onRing := agent.topology.(Ring)
+	if !onRing || !ring.IsCompact() {
+		return agent.topology.Node(id)
+	}
+	if node := ring.lookup(id); node != nil {
+		return node
+	}
+	scratch := &agent.scratch
+	scratch.node, scratch.label = Node{false, id, nil, nil, nil}, [2]ExploredType{}
+	if ring.compact.whiteboards {
+		scratch.whiteboard = Whiteboard{label: scratch.label[:], updateForAgent: None}
+		scratch.node.whiteboard = &scratch.whiteboard
+	}
+	if ring.compact.tokens {
+		scratch.tokens = Tokens{}
+		scratch.node.tokens = &scratch.tokens
+	}
+	return &scratch.node
+}
+
+// current returns the node the agent stands on to read from it, the allocated one once another agent wrote on it
+func (agent *Agent) current() *Node {
+	if agent.position != &agent.scratch.node {
+		return agent.position
+	}
+	if node := agent.topology.(Ring).lookup(agent.position.ID); node != nil {
+		agent.position = node
+	}
+	return agent.position
+}
+
+// writable returns the node the agent stands on to write on it, allocating it first if it stood on its scratch node
+func (agent *Agent) writable() *Node {
+	if agent.position == &agent.scratch.node {
+		agent.position = agent.topology.Node(agent.position.ID)
+	}
+	return agent.position
+}
+
+// relock hands the lock the agent holds on the whiteboard it read over to the one it writes on, which it allocates first if need be
+func (agent *Agent) relock(whiteboard *Whiteboard) *Whiteboard {
+	if agent.position != &agent.scratch.node {
+		return whiteboard
+	}
+	whiteboard.Unlock()
+	whiteboard = agent.writable().whiteboard
+	whiteboard.Lock()
+	return whiteboard
+}
@@ -0,0 +1,182 @@
+package bhs
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Status is what an agent was doing when a search was cancelled
+type Status uint8
+
+// Statuses
+const (
+	Running   Status = iota // 0: acting, or blocked outside the scheduler, e.g. on a channel of the algorithm
+	Scheduled               // 1: waiting for the scheduler to let it act
+	Done                    // 2: terminated
+	Lost                    // 3: destroyed
+)
+
+// actionNames tell what an agent waits for the scheduler to let it do
+var actionNames = map[Action]string{MoveAction: "move", WhiteboardAction: "access the whiteboard", TokenAction: "access the tokens", WaitAction: "wait"}
+
+// Whereabouts is where an agent was, and what it was doing, when a search was cancelled
+type Whereabouts struct {
+	Agent  int    // in the order agents were created
+	Node   NodeID // the agent was last on, whether or not the ring is anonymous
+	Status Status
+	Action Action // the agent waited for the scheduler to let it take, when Scheduled
+}
+
+func (whereabouts Whereabouts) String() string {
+	switch whereabouts.Status {
+	case Scheduled:
+		return fmt.Sprintf("agent %d waits for the scheduler to %s on node %d", whereabouts.Agent, actionNames[whereabouts.Action], whereabouts.Node)
+	case Done:
+		return fmt.Sprintf("agent %d is done on node %d", whereabouts.Agent, whereabouts.Node)
+	case Lost:
+		return fmt.Sprintf("agent %d was destroyed on node %d", whereabouts.Agent, whereabouts.Node)
+	}
+	return fmt.Sprintf("agent %d is blocked outside the scheduler on node %d", whereabouts.Agent, whereabouts.Node)
+}
+
+// HangError is what RunContext returns when the search was cancelled before it returned, with where each agent was
+type HangError struct {
+	Err    error // why the search was cancelled, e.g. context.DeadlineExceeded
+	Agents []Whereabouts
+}
+
+func (err *HangError) Error() string {
+	if len(err.Agents) == 0 {
+		return fmt.Sprintf("search cancelled before it returned (%v), no agent was created", err.Err)
+	}
+	agents, over := make([]string, 0, len(err.Agents)), true
+	for _, whereabouts := range err.Agents {
+		agents = append(agents, whereabouts.String())
+		over = over && (whereabouts.Status == Done || whereabouts.Status == Lost)
+	}
+	message := fmt.Sprintf("search cancelled before it returned (%v): %s", err.Err, strings.Join(agents, ", "))
+	if over {
+		message += ", so the search waits for something no agent will send"
+	}
+	return message
+}
+
+// Unwrap returns why the search was cancelled, so errors.Is tells a timeout
+func (err *HangError) Unwrap() error {
+	return err.Err
+}
+
+// execution follows the agents of a search run by RunContext, to stop them once it is cancelled and tell where they were
+type execution struct {
+	sync.Mutex
+	agents    []Whereabouts // in the order they were created
+	cancelled bool
+	done      chan struct{} // closed once cancelled, for the search to stop waiting for what its agents send
+}
+
+// waker is a scheduler blocking agents until others act, it wakes them all up once their search is cancelled
+type waker interface {
+	wake()
+}
+
+// join starts following an agent
+func (execution *execution) join(agent *Agent) {
+	execution.Lock()
+	defer execution.Unlock()
+	agent.index = len(execution.agents)
+	execution.agents = append(execution.agents, Whereabouts{agent.index, agent.position.ID, Running, WaitAction})
+}
+
+// update records what the agent is doing, then ends its goroutine if the search was cancelled
+// Goexit runs the calls the agent deferred, e.g. Terminate, which lets the scheduler go on with the others
+func (execution *execution) update(agent *Agent, status Status, action Action) {
+	execution.Lock()
+	execution.agents[agent.index] = Whereabouts{agent.index, agent.position.ID, status, action}
+	cancelled := execution.cancelled
+	execution.Unlock()
+	if cancelled && status != Done && status != Lost {
+		runtime.Goexit()
+	}
+}
+
+// cancel stops agents at their next action, including those the scheduler blocks, and returns where each was
+func (execution *execution) cancel(err error, scheduler Scheduler) *HangError {
+	execution.Lock()
+	execution.cancelled = true
+	close(execution.done)
+	hang := &HangError{err, append([]Whereabouts{}, execution.agents...)}
+	execution.Unlock()
+	if waker, blocks := scheduler.(waker); blocks {
+		waker.wake()
+	}
+	return hang
+}
+
+// canceller tells a search that its agents stopped, so what it still waits for will never come
+// It is the execution of a search run by RunContext, or a scheduler that knows when agents are over
+type canceller interface {
+	over() <-chan struct{} // closed once agents stopped, nil if they never do
+	starved()              // the search waited for what agents never sent
+}
+
+func (execution *execution) over() <-chan struct{} { return execution.done }
+func (execution *execution) starved()              {}
+
+// Receive waits for what an agent of the team sends on the channel, or returns the zero value once the agents stopped
+// Agents stop once RunContext cancels the search, or once every agent ended under model checking, without sending anything more
+// Searches wait for their agents with it, so that they return rather than wait for good
+func Receive[T any](team *Team, channel <-chan T) T {
+	team.Lock()
+	canceller := team.canceller
+	team.Unlock()
+	var stopped <-chan struct{}
+	if canceller != nil {
+		stopped = canceller.over()
+	}
+	select {
+	case value := <-channel:
+		return value
+	case <-stopped:
+		select {
+		case value := <-channel: // sent before the agents stopped
+			return value
+		default:
+			canceller.starved()
+			var zero T
+			return zero
+		}
+	}
+}
+
+// RunContext runs a search on the ring until it returns, or until the context is done, e.g. past its deadline
+// Once it is done, agents stop at their next action and a HangError tells where each of them was
+// It then waits for the search to return, which it does once it selects on Team.Cancelled while waiting for its agents
+func RunContext(ctx context.Context, ring Ring, scheduler Scheduler, search func(Ring, Scheduler) Result) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	execution := &execution{done: make(chan struct{})}
+	ring.execution = execution
+
+	results, returned := make(chan Result, 1), make(chan struct{})
+	go func() {
+		defer close(returned) // even if an agent stopped the goroutine, as with an engine or a SequentialScheduler
+		results <- search(ring, scheduler)
+	}()
+	select {
+	case result := <-results:
+		return result, nil
+	case <-ctx.Done():
+		select { // the search may have returned just in time
+		case result := <-results:
+			return result, nil
+		default:
+		}
+	}
+	hang := execution.cancel(ctx.Err(), scheduler)
+	<-returned
+	return Result{}, hang
+}
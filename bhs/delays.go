@@ -0,0 +1,95 @@
+package bhs
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// directedLink is a link of the ring crossed from a node in a global direction
+type directedLink struct {
+	from      NodeID
+	direction Direction
+}
+
+// delays holds how long links take to cross, and when the last agent to enter each of them gets across
+type delays struct {
+	sync.Mutex
+	delay       func(link directedLink, crossings uint64) uint64 // time units, given how many times the link was crossed before
+	crossings   map[NodeID]uint64                                // per link, identified by the node it leaves to the left
+	lastArrival map[directedLink]uint64
+}
+
+// ConstantDelays makes every link take the given number of time units to cross
+func ConstantDelays(delay uint64) RingOption {
+	return func(ring *Ring) {
+		ring.delays = newDelays(func(link directedLink, crossings uint64) uint64 {
+			return delay
+		})
+	}
+}
+
+// RandomDelays makes each link take from 1 to max time units to cross in each direction, picked from the seed
+func RandomDelays(max uint64, seed int64) RingOption {
+	return func(ring *Ring) {
+		if max < 1 {
+			max = 1
+		}
+		random := rand.New(rand.NewSource(seed))
+		linkDelays := make(map[directedLink]uint64)
+		for id := NodeID(0); id < ring.size; id++ {
+			for _, direction := range []Direction{Left, Right} {
+				linkDelays[directedLink{id, direction}] = 1 + uint64(random.Int63n(int64(max)))
+			}
+		}
+		ring.delays = newDelays(func(link directedLink, crossings uint64) uint64 {
+			return linkDelays[link]
+		})
+	}
+}
+
+// AdversarialDelays makes the first crossing of each link take max time units, and the following ones a single one
+// Exploring the ring is then as slow as it gets, while going back through explored links stays fast
+func AdversarialDelays(max uint64) RingOption {
+	return func(ring *Ring) {
+		ring.delays = newDelays(func(link directedLink, crossings uint64) uint64 {
+			if crossings == 0 {
+				return max
+			}
+			return 1
+		})
+	}
+}
+
+func newDelays(delay func(link directedLink, crossings uint64) uint64) *delays {
+	return &delays{delay: delay, crossings: make(map[NodeID]uint64), lastArrival: make(map[directedLink]uint64)}
+}
+
+// enter tells how long it takes the agent to cross the link behind a port of its node: at least delay steps, and until the time of arrival
+// Agents get across a link in the order they entered it, so an agent may take longer than the link's delay
+// Without a scheduler to tell the time, every link takes a single step
+func (ring Ring) enter(agent *Agent, port Direction) (delay uint64, arrival uint64) {
+	if ring.delays == nil || agent.scheduler == nil {
+		return 1, 0
+	}
+
+	from, direction := agent.position.ID, ring.port(agent.position.ID, port)
+	link, undirected := directedLink{from, direction}, from
+	if direction == Right {
+		undirected, _ = ring.Neighbour(from, port)
+	}
+
+	delays, now := ring.delays, agent.scheduler.Time()
+	delays.Lock()
+	defer delays.Unlock()
+	delay = delays.delay(link, delays.crossings[undirected])
+	if delay < 1 {
+		delay = 1
+	}
+	delays.crossings[undirected]++
+	arrival = now + delay
+	if arrival < delays.lastArrival[link] { // first in, first out
+		arrival = delays.lastArrival[link]
+	}
+	delays.lastArrival[link] = arrival
+	return delay, arrival
+}
@@ -0,0 +1,99 @@
+package bhs
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// directionNames names the directions agents leave updates for
+var directionNames = map[Direction]string{Left: "left", Right: "right", None: "none"}
+
+// WriteDOT writes the state of the ring as a Graphviz DOT graph, at the end of a run or while agents are at it
+// Nodes are labelled with their ID, whether they are black or gray holes, and the contents of their whiteboard
+// The whiteboard is also in their updateForAgent, unexploredSet, homebaseNodeID and actAsSmall attributes
+// Each link is labelled with the cautious walk label of both its ends, e.g. `circo -Tsvg ring.dot` draws it
+// It locks each whiteboard in turn, so never call it from a Tracer: agents trace some events with a whiteboard locked
+func (ring Ring) WriteDOT(writer io.Writer) error {
+	var dot strings.Builder
+	dot.WriteString("graph ring {\n\tlayout=circo\n\tnode [shape=circle fontname=monospace]\n\tedge [fontname=monospace fontsize=8]\n")
+
+	nodes := make([]*Node, 0, ring.size)
+	for id := NodeID(0); id < ring.size; id++ {
+		node := ring.lookup(id)
+		if node == nil { // as no agent used it yet in a compact ring
+			node = ring.compact.newNode(id)
+		}
+		nodes = append(nodes, node)
+	}
+
+	for _, node := range nodes {
+		label := []string{fmt.Sprint(node.ID)}
+		attributes := ""
+		switch {
+		case node.BlackHole:
+			label = append(label, "black hole")
+			attributes += " style=filled fillcolor=black fontcolor=white"
+		case node.grayHole != nil:
+			label = append(label, "gray hole")
+			attributes += " style=filled fillcolor=gray"
+		}
+		for _, homebase := range ring.homebases {
+			if node.ID == homebase {
+				label = append(label, "homebase")
+				attributes += " shape=doublecircle"
+			}
+		}
+
+		if whiteboard := node.whiteboard; whiteboard != nil {
+			whiteboard.Lock()
+			unexploredSet := ""
+			if whiteboard.unexploredSet != [2]NodeID{} { // erased once the update is read
+				unexploredSet = fmt.Sprintf("%d..%d", whiteboard.unexploredSet[0], whiteboard.unexploredSet[1])
+				label = append(label, fmt.Sprintf("update for %s", directionNames[whiteboard.updateForAgent]), "unexplored "+unexploredSet, fmt.Sprintf("homebase %d", whiteboard.homebaseNodeID))
+				if whiteboard.actAsSmall {
+					label = append(label, "act as small")
+				}
+			}
+			attributes += fmt.Sprintf(" updateForAgent=%s unexploredSet=%q homebaseNodeID=%d actAsSmall=%t", directionNames[whiteboard.updateForAgent], unexploredSet, whiteboard.homebaseNodeID, whiteboard.actAsSmall)
+			whiteboard.Unlock()
+		}
+		fmt.Fprintf(&dot, "\t%d [label=%q%s]\n", node.ID, strings.Join(label, "\n"), attributes)
+	}
+
+	// links from each node to the next, labelled at the node's end with its left port and at the next one's with its right port
+	for _, node := range nodes {
+		next, back := ring.Neighbour(node.ID, ring.port(node.ID, Left))
+		labels := [2]ExploredType{ring.label(node.ID, ring.port(node.ID, Left)), ring.label(next, back)}
+		colour := "gray"
+		switch {
+		case ring.isBlackLink(node.ID, ring.port(node.ID, Left)):
+			colour = "red"
+		case labels[0] == active || labels[1] == active:
+			colour = "orange"
+		case labels[0] == explored || labels[1] == explored:
+			colour = "darkgreen"
+		}
+		if node.whiteboard == nil {
+			fmt.Fprintf(&dot, "\t%d -- %d [color=%s]\n", node.ID, next, colour)
+			continue
+		}
+		fmt.Fprintf(&dot, "\t%d -- %d [taillabel=%s headlabel=%s color=%s]\n", node.ID, next, labels[0], labels[1], colour)
+	}
+	dot.WriteString("}\n")
+
+	_, err := io.WriteString(writer, dot.String())
+	return err
+}
+
+// label returns the cautious walk label of the link behind a port of a node, unexplored without a whiteboard
+func (ring Ring) label(id NodeID, port Direction) ExploredType {
+	node := ring.lookup(id)
+	if node == nil || node.whiteboard == nil {
+		return unexplored
+	}
+	whiteboard := node.whiteboard
+	whiteboard.Lock()
+	defer whiteboard.Unlock()
+	return whiteboard.label[port]
+}
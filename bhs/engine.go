@@ -0,0 +1,105 @@
+package bhs
+
+import "container/heap"
+
+// Machine is an agent written as a state machine, for an Engine to step
+// Step takes the agent's next actions, up to a single move or wait, and returns whether the agent is done
+// A step taking no time waits a time unit, so the agent still acts once a round
+type Machine interface {
+	Step() bool
+}
+
+// event is the next step of an agent, due once the clock of the agent comes first
+type event struct {
+	agent   *Agent
+	machine Machine
+	clock   uint64 // time units the agent took so far
+	order   int    // in which the agent was added, agents with the same clock step in this order
+}
+
+// events are the steps due, a priority queue by clock then order
+type events []*event
+
+func (events events) Len() int { return len(events) }
+func (events events) Less(i, j int) bool {
+	return events[i].clock < events[j].clock || events[i].clock == events[j].clock && events[i].order < events[j].order
+}
+func (events events) Swap(i, j int)       { events[i], events[j] = events[j], events[i] }
+func (events *events) Push(x interface{}) { *events = append(*events, x.(*event)) }
+func (events *events) Pop() interface{} {
+	old := *events
+	last := old[len(old)-1]
+	old[len(old)-1] = nil
+	*events = old[:len(old)-1]
+	return last
+}
+
+// Engine runs agents written as state machines on the calling goroutine, in place of a goroutine each
+// An event loop steps the agent with the earliest clock, and agents with the same clock in the order they were added
+// Moves and waits take a time unit as with the SynchronousScheduler, a run then only depends on its inputs
+type Engine struct {
+	events  events
+	current *event // being stepped, nil between steps
+	added   int
+	time    uint64 // latest time any agent got to
+}
+
+// NewEngine helps construct an event engine
+func NewEngine() *Engine {
+	return &Engine{}
+}
+
+// Add gives the engine a machine to step, for an agent created with the engine as its scheduler
+func (engine *Engine) Add(agent *Agent, machine Machine) {
+	heap.Push(&engine.events, &event{agent, machine, 0, engine.added})
+	engine.added++
+}
+
+// Join does nothing, agents take part once their machine is added
+func (engine *Engine) Join(agent *Agent) {}
+
+// Leave does nothing, the engine lets go of an agent once its machine is done
+func (engine *Engine) Leave(agent *Agent) {}
+
+// Start runs the event loop until every machine is done, terminating their agents
+func (engine *Engine) Start() {
+	for engine.events.Len() > 0 {
+		event := heap.Pop(&engine.events).(*event)
+		engine.current = event
+		clock := event.clock
+		done := event.machine.Step()
+		if !done && event.clock == clock && !event.agent.terminated {
+			event.agent.Wait()
+		}
+		engine.current = nil
+
+		if done || event.agent.terminated {
+			event.agent.Terminate()
+			continue
+		}
+		heap.Push(&engine.events, event)
+	}
+}
+
+// Step advances the clock of the agent being stepped, only moves and waits take time
+// Agents that aren't stepped by the engine, e.g. in a goroutine of their own, have no clock to advance
+func (engine *Engine) Step(agent *Agent, action Action) {
+	if engine.current == nil || engine.current.agent != agent {
+		panic("an agent isn't stepped by the engine, its machine must be added to it")
+	}
+	if action != MoveAction && action != WaitAction {
+		return
+	}
+	engine.current.clock++
+	if engine.current.clock > engine.time {
+		engine.time = engine.current.clock
+	}
+}
+
+// Time returns the clock of the agent being stepped, or the latest time any agent got to between steps
+func (engine *Engine) Time() uint64 {
+	if engine.current != nil {
+		return engine.current.clock
+	}
+	return engine.time
+}
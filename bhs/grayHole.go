@@ -0,0 +1,85 @@
+package bhs
+
+import "sync"
+
+// grayHole destroys some of the agents arriving on a node, it is a black hole that sometimes lets agents through
+type grayHole struct {
+	sync.Mutex
+	probability float64
+	seed        int64
+	every       uint64 // 0 if the gray hole destroys agents with a probability
+	visits      uint64
+	agents      map[*Agent]uint64 // number of each agent, in the order they spawned on the ring
+	visitsOf    map[*Agent]uint64 // visits of each agent so far
+}
+
+// GrayHole turns the black hole given to BuildRing into a gray hole, destroying each arriving agent with a probability
+// Each draw comes from the seed, the agent and how many times it visited, so the agents destroyed don't depend on the order they arrive in
+func GrayHole(probability float64, seed int64) RingOption {
+	return func(ring *Ring) {
+		ring.grayHole(&grayHole{probability: probability, seed: seed})
+	}
+}
+
+// GrayHoleEvery turns the black hole given to BuildRing into a gray hole, destroying every k-th arriving agent
+// Which agent that is goes by the order they arrive in
+func GrayHoleEvery(k uint64) RingOption {
+	return func(ring *Ring) {
+		ring.grayHole(&grayHole{every: k})
+	}
+}
+
+// grayHole replaces the black holes of the ring with gray holes
+func (ring *Ring) grayHole(grayHole *grayHole) {
+	grayHole.agents, grayHole.visitsOf = make(map[*Agent]uint64), make(map[*Agent]uint64)
+	ring.grayHoles = grayHole
+	for _, node := range ring.allocated() {
+		if node.BlackHole {
+			node.BlackHole, node.grayHole = false, grayHole
+		}
+	}
+}
+
+// IsGrayHole returns whether the node may destroy the agents arriving on it
+func (node *Node) IsGrayHole() bool {
+	return node.grayHole != nil
+}
+
+// spawn numbers an agent starting on the ring
+func (grayHole *grayHole) spawn(agent *Agent) {
+	if grayHole == nil {
+		return
+	}
+	grayHole.Lock()
+	grayHole.agents[agent] = uint64(len(grayHole.agents))
+	grayHole.Unlock()
+}
+
+// destroys counts a visit to the gray hole, and returns whether it destroys the visiting agent
+func (grayHole *grayHole) destroys(agent *Agent) bool {
+	if grayHole == nil {
+		return false
+	}
+	grayHole.Lock()
+	defer grayHole.Unlock()
+
+	grayHole.visits++
+	if grayHole.every != 0 {
+		return grayHole.visits%grayHole.every == 0
+	}
+	grayHole.visitsOf[agent]++
+	return draw(grayHole.seed, grayHole.agents[agent], grayHole.visitsOf[agent]) < grayHole.probability
+}
+
+// draw returns a number in [0, 1) that only depends on the seed, the agent's number and its visit
+func draw(seed int64, agent uint64, visit uint64) float64 {
+	return float64(mix(mix(mix(uint64(seed))^agent)^visit)>>11) / (1 << 53)
+}
+
+// mix scrambles the bits of a number, as the output function of splitmix64 does
+func mix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
@@ -0,0 +1,69 @@
+package bhs
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// jsonEvent is the schema of a line of a JSON trace, keys are never renamed nor removed
+// to, port, direction, label and unexplored are only there when the event has them
+type jsonEvent struct {
+	Sequence   uint64     `json:"seq"`  // logical timestamp, from 0
+	Time       uint64     `json:"time"` // time of the scheduler
+	Kind       string     `json:"kind"` // spawned, moved, label_changed, update_written, update_read, destroyed, terminated, walk_started or walk_ended
+	Agent      uint64     `json:"agent"`
+	Node       NodeID     `json:"node"`
+	To         *NodeID    `json:"to,omitempty"`         // moved, destroyed by a black link, or walk_started
+	Port       *uint8     `json:"port,omitempty"`       // local port of node
+	Direction  string     `json:"direction,omitempty"`  // left (towards node+1) or right (towards node-1), whatever the port labels
+	Label      string     `json:"label,omitempty"`      // active or explored, for label_changed
+	Unexplored *[2]NodeID `json:"unexplored,omitempty"` // unexplored set of update_written and update_read, as the agent counts it
+}
+
+// JSONTracer writes every event as a JSON object on its own line
+type JSONTracer struct {
+	sync.Mutex
+	encoder *json.Encoder
+	err     error
+}
+
+// NewJSONTracer helps construct a tracer writing JSON lines
+func NewJSONTracer(writer io.Writer) *JSONTracer {
+	return &JSONTracer{encoder: json.NewEncoder(writer)}
+}
+
+// Trace writes the event on its own line, it does nothing once a write failed
+func (tracer *JSONTracer) Trace(event Event) {
+	tracer.Lock()
+	defer tracer.Unlock()
+	if tracer.err != nil {
+		return
+	}
+
+	line := jsonEvent{Sequence: event.Sequence, Time: event.Time, Kind: event.Kind.String(), Agent: event.Agent, Node: event.Node}
+	if event.Kind == AgentMoved || event.Kind == WalkStarted || (event.Kind == AgentDestroyed && event.To != event.Node) {
+		to := event.To
+		line.To = &to
+	}
+	if event.Port != None {
+		port := uint8(event.Port)
+		line.Port = &port
+		line.Direction = map[Direction]string{Left: "left", Right: "right"}[event.Direction]
+	}
+	if event.Kind == LabelChanged {
+		line.Label = event.Label.String()
+	}
+	if event.Kind == UpdateWritten || event.Kind == UpdateRead {
+		unexplored := event.Unexplored
+		line.Unexplored = &unexplored
+	}
+	tracer.err = tracer.encoder.Encode(line)
+}
+
+// Err returns the error of the first write that failed, if any
+func (tracer *JSONTracer) Err() error {
+	tracer.Lock()
+	defer tracer.Unlock()
+	return tracer.err
+}
@@ -0,0 +1,27 @@
+package bhs
+
+import "runtime"
+
+// Memory is what a run took from the heap
+type Memory struct {
+	Allocated   uint64 // bytes allocated over the run, whether or not they were freed since
+	Allocations uint64 // objects allocated over the run
+	Live        uint64 // bytes still in use once the run is over and garbage is collected, e.g. by the ring
+}
+
+// MeasureMemory runs the function, e.g. building a ring and searching it, and measures what it took from the heap
+// Measures are over the whole program, so nothing else should run meanwhile
+func MeasureMemory(run func()) Memory {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	run()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	memory := Memory{after.TotalAlloc - before.TotalAlloc, after.Mallocs - before.Mallocs, 0}
+	if after.HeapAlloc > before.HeapAlloc {
+		memory.Live = after.HeapAlloc - before.HeapAlloc
+	}
+	return memory
+}
@@ -0,0 +1,439 @@
+package bhs
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// modelCheckSteps is the number of steps after which a run is deemed to never end
+const modelCheckSteps = 100000
+
+// ModelStep is a step of a schedule: the agent picked, and the whiteboard or tokens it accesses
+type ModelStep struct {
+	Agent  int // agents are numbered from 0 in the order they joined the scheduler
+	Action Action
+	Node   NodeID
+}
+
+func (step ModelStep) String() string {
+	switch step.Action {
+	case WhiteboardAction:
+		return fmt.Sprintf("agent %d accesses the whiteboard of node %d", step.Agent, step.Node)
+	case TokenAction:
+		return fmt.Sprintf("agent %d accesses the tokens of node %d", step.Agent, step.Node)
+	}
+	return fmt.Sprintf("agent %d leaves node %d", step.Agent, step.Node)
+}
+
+// shared returns whether the step accesses what other agents may access too, the whiteboard or tokens of a node
+func (step ModelStep) shared() bool {
+	return step.Action == WhiteboardAction || step.Action == TokenAction
+}
+
+// conflicts returns whether the order of two steps of different agents may matter, which is when they access the same node
+func (step ModelStep) conflicts(other ModelStep) bool {
+	return step.Agent != other.Agent && step.Node == other.Node && step.shared() && other.shared()
+}
+
+// commutes returns whether two steps lead to the same state whatever their order, never the case for steps of the same agent
+func (step ModelStep) commutes(other ModelStep) bool {
+	return step.Agent != other.Agent && !step.conflicts(other)
+}
+
+// ModelCheckReport tells how model checking went
+type ModelCheckReport struct {
+	Runs           int
+	Complete       bool        // whether every schedule that may change the outcome was run, rather than stopping at the limit
+	Counterexample []ModelStep // schedule of the run rejected, nil if there was none
+	Err            error       // why the run was rejected
+}
+
+// Schedule lists the steps of the counterexample, one per line
+func (report ModelCheckReport) Schedule() string {
+	var schedule strings.Builder
+	for i, step := range report.Counterexample {
+		fmt.Fprintf(&schedule, "%4d  %s\n", i, step)
+	}
+	return schedule.String()
+}
+
+// ModelCheck runs a search under every schedule of its agents that may change its outcome, until check rejects one
+// run must build a new ring and search it with the scheduler given, it is called once per schedule
+// Agents only get to act in turns at whiteboard and token accesses: moves are their own business, and so is time
+// Two schedules only differing in the order of accesses to different nodes are the same, so only one of them is run
+// A run where every agent ended while the search still waits for what they send, through Receive, is a deadlock
+// Agents must only wait for one another through the scheduler, e.g. on whiteboards or tokens, one whose agents never stop is rejected too
+func ModelCheck(run func(scheduler Scheduler) Result, check func(result Result) error, maxRuns int) ModelCheckReport {
+	var report ModelCheckReport
+	var prefix []int
+	sleeping := make(map[int]ModelStep)
+	var stack []modelChoice // choices made at each step of the last run
+	for report.Runs < maxRuns {
+		report.Runs++
+		scheduler := newModelScheduler(prefix, sleeping)
+		err := scheduler.execute(run, check)
+		states, redundant := scheduler.schedule()
+		if err != nil {
+			for _, state := range states {
+				report.Counterexample = append(report.Counterexample, state.enabled[state.picked])
+			}
+			report.Err = err
+			return report
+		}
+
+		for _, state := range states[len(prefix):redundant] {
+			picked := state.enabled[state.picked].Agent
+			stack = append(stack, modelChoice{state, map[int]bool{picked: true}, map[int]bool{picked: true}})
+		}
+		backtrack(stack, len(prefix))
+
+		// the next run goes another way at the last step it can
+		prefix = nil
+		for depth := len(stack) - 1; depth >= 0 && prefix == nil; depth-- {
+			choice := &stack[depth]
+			for _, agent := range choice.pending() {
+				var done []ModelStep // the other ways taken from there, which the next run must not take again
+				for agent := range choice.done {
+					done = append(done, choice.step(agent))
+				}
+				choice.done[agent] = true
+				choice.picked = choice.index(agent)
+				stack = stack[:depth+1]
+				for _, choice := range stack {
+					prefix = append(prefix, choice.enabled[choice.picked].Agent)
+				}
+				sleeping = choice.wake(done)
+				break
+			}
+		}
+		if prefix == nil {
+			report.Complete = true
+			return report
+		}
+	}
+	return report
+}
+
+// modelState is the next step of every agent waiting to act, one of which was picked
+// Sleeping agents are the ones whose next step was already taken from an equivalent state, in another run
+type modelState struct {
+	enabled  []ModelStep // by agent
+	picked   int
+	sleeping map[int]ModelStep
+}
+
+// index returns the index of the agent's step among the steps enabled, -1 if it isn't waiting to act
+func (state modelState) index(agent int) int {
+	for i, step := range state.enabled {
+		if step.Agent == agent {
+			return i
+		}
+	}
+	return -1
+}
+
+// step returns the next step of an agent waiting to act
+func (state modelState) step(agent int) ModelStep {
+	return state.enabled[state.index(agent)]
+}
+
+// wake returns the agents still sleeping once the agent picked acted, along with the other steps given
+func (state modelState) wake(others []ModelStep) map[int]ModelStep {
+	picked := state.enabled[state.picked]
+	sleeping := make(map[int]ModelStep)
+	for _, step := range others {
+		if step.commutes(picked) {
+			sleeping[step.Agent] = step
+		}
+	}
+	for agent, step := range state.sleeping {
+		if step.commutes(picked) {
+			sleeping[agent] = step
+		}
+	}
+	return sleeping
+}
+
+// modelChoice is a step of the runs explored, with the agents to pick there in other runs
+type modelChoice struct {
+	modelState
+	backtrack map[int]bool
+	done      map[int]bool
+}
+
+// pending returns the agents still to pick at this step, in increasing order
+func (choice modelChoice) pending() []int {
+	var pending []int
+	for agent := range choice.backtrack {
+		if _, sleeping := choice.sleeping[agent]; !choice.done[agent] && !sleeping {
+			pending = append(pending, agent)
+		}
+	}
+	sort.Ints(pending)
+	return pending
+}
+
+// backtrack marks where the run just explored should go another way, from the steps of the run after the given depth
+// Whenever an agent's next step depends on an earlier step of another agent, which it doesn't know of yet, the other
+// order is also worth running: the agent is picked before that step in another run, as in dynamic partial order reduction
+func backtrack(stack []modelChoice, from int) {
+	clocks := make(map[int]map[int]int) // latest step of each agent every agent knows of, numbered from 1
+	nodes := make(map[NodeID]map[int]int)
+	merge := func(clock map[int]int, other map[int]int) {
+		for agent, step := range other {
+			if step > clock[agent] {
+				clock[agent] = step
+			}
+		}
+	}
+
+	for depth, choice := range stack {
+		if depth >= from {
+			for _, next := range choice.enabled {
+				for earlier := depth - 1; earlier >= 0; earlier-- {
+					step := stack[earlier].enabled[stack[earlier].picked]
+					if !step.conflicts(next) {
+						continue
+					}
+					if clocks[next.Agent][step.Agent] < earlier+1 { // the agent doesn't know of that step yet
+						addBacktrack(&stack[earlier], next.Agent)
+					}
+					break
+				}
+			}
+		}
+
+		step := choice.enabled[choice.picked]
+		if clocks[step.Agent] == nil {
+			clocks[step.Agent] = make(map[int]int)
+		}
+		if step.shared() {
+			if nodes[step.Node] == nil {
+				nodes[step.Node] = make(map[int]int)
+			}
+			merge(clocks[step.Agent], nodes[step.Node])
+			clocks[step.Agent][step.Agent] = depth + 1
+			merge(nodes[step.Node], clocks[step.Agent])
+		} else {
+			clocks[step.Agent][step.Agent] = depth + 1
+		}
+	}
+}
+
+// addBacktrack picks the agent at the step in another run, or every agent if it wasn't waiting to act then
+func addBacktrack(choice *modelChoice, agent int) {
+	for _, step := range choice.enabled {
+		if step.Agent == agent {
+			choice.backtrack[agent] = true
+			return
+		}
+	}
+	for _, step := range choice.enabled {
+		choice.backtrack[step.Agent] = true
+	}
+}
+
+// modelScheduler lets a single agent act at a time, following a prefix of picks then picking the first agent awake
+// The agent acting goes on through moves and waits, it only hands the turn over at whiteboard and token accesses
+type modelScheduler struct {
+	sync.Mutex
+	turn      *sync.Cond
+	agents    []*Agent // in the order they joined
+	left      map[*Agent]bool
+	ended     map[*Agent]bool // agents whose goroutine is over, the search waits for nothing more once they all are
+	stopped   chan struct{}   // closed once every agent ended
+	waiting   map[*Agent]Action
+	running   *Agent
+	started   bool
+	time      uint64
+	prefix    []int
+	sleeping  map[int]ModelStep // once past the prefix
+	states    []modelState
+	redundant int   // first step from which the run is equivalent to one already run, as every agent waiting was sleeping
+	err       error // why the scheduler stopped picking agents, agents waiting to act then end their goroutines
+}
+
+func newModelScheduler(prefix []int, sleeping map[int]ModelStep) *modelScheduler {
+	scheduler := &modelScheduler{left: make(map[*Agent]bool), ended: make(map[*Agent]bool), stopped: make(chan struct{}), waiting: make(map[*Agent]Action), prefix: prefix, sleeping: sleeping, redundant: -1}
+	scheduler.turn = sync.NewCond(scheduler)
+	return scheduler
+}
+
+// Join adds an agent to the agents being scheduled
+func (scheduler *modelScheduler) Join(agent *Agent) {
+	scheduler.Lock()
+	scheduler.agents = append(scheduler.agents, agent)
+	scheduler.Unlock()
+}
+
+// Leave removes an agent from the agents being scheduled, and hands the turn over if it was acting
+func (scheduler *modelScheduler) Leave(agent *Agent) {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	scheduler.left[agent] = true
+	delete(scheduler.waiting, agent)
+	if scheduler.running == agent {
+		scheduler.running = nil
+	}
+	if agent.ended && !scheduler.ended[agent] {
+		if scheduler.ended[agent] = true; len(scheduler.ended) == len(scheduler.agents) {
+			close(scheduler.stopped)
+		}
+	}
+	scheduler.dispatch()
+}
+
+func (scheduler *modelScheduler) over() <-chan struct{} { return scheduler.stopped }
+
+// starved rejects the run, as the search waits for what agents that all ended never sent
+func (scheduler *modelScheduler) starved() {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	if scheduler.err == nil {
+		scheduler.reject(fmt.Errorf("deadlock, the search waits for what no agent sends: %s", scheduler.describe()))
+	}
+}
+
+// Start lets the first agent act once every agent that joined is waiting
+func (scheduler *modelScheduler) Start() {
+	scheduler.Lock()
+	scheduler.started = true
+	scheduler.dispatch()
+	scheduler.Unlock()
+}
+
+// Step blocks the agent until it is picked, unless it is acting and only moves or waits
+func (scheduler *modelScheduler) Step(agent *Agent, action Action) {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+
+	scheduler.time++
+	if scheduler.running == agent && (action == MoveAction || action == WaitAction) {
+		return
+	}
+	scheduler.waiting[agent] = action
+	if scheduler.running == agent {
+		scheduler.running = nil
+	}
+	scheduler.dispatch()
+	for scheduler.running != agent {
+		if scheduler.err != nil { // the run was rejected, Goexit runs the calls the agent deferred, e.g. Terminate
+			runtime.Goexit()
+		}
+		scheduler.turn.Wait()
+	}
+	delete(scheduler.waiting, agent)
+}
+
+// Time returns the number of actions taken so far
+func (scheduler *modelScheduler) Time() uint64 {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	return scheduler.time
+}
+
+// dispatch picks the next agent if nobody is acting and every agent is waiting, must be called with the lock held
+func (scheduler *modelScheduler) dispatch() {
+	if !scheduler.started || scheduler.running != nil || scheduler.err != nil {
+		return
+	}
+	var enabled []ModelStep
+	for index, agent := range scheduler.agents {
+		if scheduler.left[agent] {
+			continue
+		}
+		action, waiting := scheduler.waiting[agent]
+		if !waiting {
+			return
+		}
+		enabled = append(enabled, ModelStep{index, action, agent.position.ID})
+	}
+	if len(enabled) == 0 {
+		return
+	}
+
+	depth, picked, sleeping := len(scheduler.states), 0, map[int]ModelStep(nil)
+	switch {
+	case depth < len(scheduler.prefix):
+		for picked = range enabled {
+			if enabled[picked].Agent == scheduler.prefix[depth] {
+				break
+			}
+		}
+		if enabled[picked].Agent != scheduler.prefix[depth] {
+			scheduler.reject(fmt.Errorf("the run went another way when replaying step %d, agents don't only depend on the schedule", depth))
+			return
+		}
+	case scheduler.redundant < 0:
+		sleeping = scheduler.sleeping
+		for picked < len(enabled) && sleeping[enabled[picked].Agent] == enabled[picked] {
+			picked++
+		}
+		if picked == len(enabled) { // the run goes on to an end, but nothing new comes out of it
+			picked, scheduler.redundant = 0, depth
+		}
+	}
+	if depth == modelCheckSteps {
+		scheduler.reject(fmt.Errorf("agents still act after %d steps", modelCheckSteps))
+		return
+	}
+	state := modelState{enabled, picked, sleeping}
+	if depth >= len(scheduler.prefix) && scheduler.redundant < 0 {
+		scheduler.sleeping = state.wake(nil)
+	}
+	scheduler.states = append(scheduler.states, state)
+	scheduler.running = scheduler.agents[enabled[picked].Agent]
+	scheduler.turn.Broadcast()
+}
+
+// reject stops picking agents, and has the agents waiting to act end their goroutines, must be called with the lock held
+func (scheduler *modelScheduler) reject(err error) {
+	scheduler.err = err
+	scheduler.turn.Broadcast()
+}
+
+// execute runs the search, and returns why the run is rejected if it is
+// The search returns whatever happens, as agents end once the run is rejected and the search then stops waiting for them
+func (scheduler *modelScheduler) execute(run func(scheduler Scheduler) Result, check func(result Result) error) error {
+	result := run(scheduler)
+	scheduler.Lock()
+	err := scheduler.err
+	scheduler.Unlock()
+	if err != nil {
+		return err
+	}
+	return check(result)
+}
+
+// describe tells where each agent is, must be called with the lock held
+func (scheduler *modelScheduler) describe() string {
+	var agents []string
+	for index, agent := range scheduler.agents {
+		_, waiting := scheduler.waiting[agent]
+		switch {
+		case !agent.Active:
+			agents = append(agents, fmt.Sprintf("agent %d was destroyed on node %d", index, agent.position.ID))
+		case scheduler.left[agent]:
+			agents = append(agents, fmt.Sprintf("agent %d is done on node %d", index, agent.position.ID))
+		case waiting:
+			agents = append(agents, fmt.Sprintf("agent %d waits to act on node %d", index, agent.position.ID))
+		default:
+			agents = append(agents, fmt.Sprintf("agent %d is blocked on node %d", index, agent.position.ID))
+		}
+	}
+	return strings.Join(agents, ", ")
+}
+
+// schedule returns the steps taken so far, along with the first one from which they are redundant
+func (scheduler *modelScheduler) schedule() ([]modelState, int) {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	redundant := scheduler.redundant
+	if redundant < 0 {
+		redundant = len(scheduler.states)
+	}
+	return append([]modelState{}, scheduler.states...), redundant
+}
@@ -0,0 +1,290 @@
+package bhs
+
+import "fmt"
+
+// phase is where a leg of a move is at
+type phase uint8
+
+// Phases
+const (
+	leaving  phase = iota // 0: on the source, about to enter the link
+	crossing              // 1: in the link, one step of time after the other
+	arriving              // 2: through the link, about to get on the destination
+	returned              // 3: back on the source with cautious walk, about to cross again
+	again                 // 4: through the link again
+)
+
+// leg is a crossing of a link, moves with cautious walk take three of them to cross an unexplored link: there, back and there again
+type leg struct {
+	port      Direction
+	back      Direction // port leading back, once through the link
+	phase     phase
+	tokenWalk bool   // whether a token on the source marks the link as active, rather than its whiteboard
+	busy      bool   // whether another agent's token marks the link as active, so the agent waits before leaving
+	comeBack  bool   // whether the agent must come back to the source once it knows the link is safe
+	steps     uint64 // taken in the link so far
+	delay     uint64 // steps the link takes to cross, at least
+	arrival   uint64 // time the agent gets across, at the earliest
+}
+
+// move is a move of an agent through a port as a state machine: each call to next takes at most a single step of time
+// The legs are a stack, the last one is in progress and those under it wait for it to end
+type move struct {
+	agent       *Agent
+	legs        []leg
+	updateFound bool // once over, as well as err, or to the leg under the one that just ended
+	err         error
+}
+
+// startMove starts a move of the agent through a local port of the current node, its legs reuse the room of the agent's last move
+func (agent *Agent) startMove(port Direction) move {
+	return move{agent, append(agent.legs[:0], legThrough(port)), false, nil}
+}
+
+// next takes the move further until the agent takes a step of time, and returns whether it did, otherwise the move is over
+func (move *move) next() bool {
+	agent := move.agent
+	for len(move.legs) > 0 {
+		leg := &move.legs[len(move.legs)-1]
+		switch leg.phase {
+		case leaving:
+			if !agent.leave(leg, move) {
+				move.legs = move.legs[:len(move.legs)-1]
+				continue
+			}
+			if leg.busy { // wait a time unit for the other agent to come back from the link, then try again
+				agent.step(WaitAction)
+				return true
+			}
+			leg.phase = crossing
+		case crossing:
+			if leg.steps < leg.delay || agent.scheduler != nil && agent.scheduler.Time() < leg.arrival {
+				leg.steps++
+				agent.step(MoveAction)
+				return true
+			}
+			leg.phase = arriving
+		case arriving:
+			if !agent.arrive(leg, move) {
+				move.legs = move.legs[:len(move.legs)-1]
+				continue
+			}
+			// go back to source to mark its outgoing edge label as explored and check for new instructions
+			leg.phase = returned
+			move.legs = append(move.legs, legThrough(leg.back))
+		case returned:
+			if move.err != nil || move.updateFound {
+				move.legs = move.legs[:len(move.legs)-1]
+				continue
+			}
+			if leg.tokenWalk {
+				if move.err = agent.pickCautionToken(leg.port); move.err != nil {
+					move.legs = move.legs[:len(move.legs)-1]
+					continue
+				}
+			}
+			// otherwise, keep doing your thing
+			leg.phase = again
+			move.legs = append(move.legs, legThrough(leg.port))
+		case again:
+			move.legs = move.legs[:len(move.legs)-1] // successful unless the last leg wasn't, nothing else to declare
+		}
+	}
+	agent.legs = move.legs
+	return false
+}
+
+// legThrough starts a leg through a local port of the current node
+func legThrough(port Direction) leg {
+	return leg{port: port}
+}
+
+// leave takes the agent into the link of the leg, returns false if the leg ends there with what the move found
+// The leg is busy instead when the agent must wait before leaving, it then leaves again after the wait
+func (agent *Agent) leave(leg *leg, move *move) bool {
+	move.updateFound, move.err = false, nil
+	if !agent.Active {
+		move.err = fmt.Errorf("non-active agent can't move")
+		return false
+	}
+	if int(leg.port) >= agent.topology.Ports(agent.position.ID) {
+		move.err = fmt.Errorf("no port %d at this node", leg.port)
+		return false
+	}
+
+	leg.tokenWalk = agent.cautiousWalk && agent.position.whiteboard == nil
+
+	// cautious walk: mark edge as active before leaving, immediately come back to mark as explored if safe
+	if leg.tokenWalk { // without whiteboards, a token dropped on the source marks the link as active
+		if leg.comeBack, leg.busy, move.err = agent.dropCautionToken(leg.port); move.err != nil || leg.busy {
+			return move.err == nil
+		}
+	} else if agent.cautiousWalk {
+		sourceNodeWhiteboard := agent.writable().whiteboard // labels the link active unless it is explored, as it is on nodes already written on
+		agent.step(WhiteboardAction)
+		sourceNodeWhiteboard.Lock()
+		if updateFound, read := agent.checkForUpdate(); updateFound { // always check for an update before moving
+			sourceNodeWhiteboard.Unlock()
+			read.emit()
+			move.updateFound = true
+			return false
+		}
+		outgoingEdgeLabel := sourceNodeWhiteboard.label[leg.port]
+		var labelled traced
+		switch outgoingEdgeLabel {
+		case unexplored:
+			sourceNodeWhiteboard.label[leg.port] = active
+			labelled = agent.event(LabelChanged, agent.position.ID, agent.position.ID, leg.port, active)
+		case active:
+			sourceNodeWhiteboard.Unlock()
+			move.err = fmt.Errorf("cannot cross an active link")
+			return false
+		}
+		sourceNodeWhiteboard.Unlock()
+		labelled.emit()
+		leg.comeBack = outgoingEdgeLabel == unexplored
+	}
+
+	leg.delay = 1
+	if ring, onRing := agent.topology.(Ring); onRing {
+		leg.delay, leg.arrival = ring.enter(agent, leg.port)
+	}
+	return true
+}
+
+// arrive gets the agent on the node at the other end of the link, returns false if the leg ends there with what the move found
+func (agent *Agent) arrive(leg *leg, move *move) bool {
+	ring, onRing := agent.topology.(Ring)
+	newIndex, back := agent.topology.Neighbour(agent.position.ID, leg.port) // back is the port leading back
+	leg.back = back
+	if onRing && ring.isBlackLink(agent.position.ID, leg.port) {
+		agent.destroy(agent.position.ID, newIndex, leg.port)
+		move.err = fmt.Errorf("destroyed by a black link")
+		return false
+	}
+
+	from := agent.position.ID
+	agent.position, agent.arrival = agent.nodeAt(newIndex), back
+	agent.track(leg.port, back)
+	agent.trace(AgentMoved, from, newIndex, leg.port, unexplored)
+
+	if agent.position.BlackHole {
+		agent.destroy(newIndex, newIndex, None)
+		move.err = fmt.Errorf("reached a black hole")
+		return false
+	}
+	if agent.position.grayHole.destroys(agent) {
+		agent.destroy(newIndex, newIndex, None)
+		move.err = fmt.Errorf("destroyed by a gray hole")
+		return false
+	}
+
+	agent.Moves++
+	if !agent.cautiousWalk {
+		return false
+	}
+
+	// Arrived at destination, mark incoming edge label as explored
+	if !leg.tokenWalk {
+		destinationSourceWhiteboard := agent.writable().whiteboard
+		agent.step(WhiteboardAction)
+		destinationSourceWhiteboard.Lock()
+		changed := destinationSourceWhiteboard.label[back] != explored
+		destinationSourceWhiteboard.label[back] = explored
+		destinationSourceWhiteboard.Unlock()
+		if changed {
+			agent.trace(LabelChanged, newIndex, newIndex, back, explored)
+		}
+	}
+
+	// Update agent's unexplored set with node just visited, it wraps around node 0 for agents starting from another homebase
+	ringSize := NodeID(agent.topology.Size())
+	switch agent.Location() {
+	case agent.UnexploredSet[1]:
+		agent.UnexploredSet[1] = (agent.UnexploredSet[1] + ringSize - 1) % ringSize // if the agent is located at the rightmost unexplored node, decrement the index of the rightmost unexplored node
+	case agent.UnexploredSet[0]:
+		agent.UnexploredSet[0] = (agent.UnexploredSet[0] + 1) % ringSize // if the agent is located at the leftmost unexplored node, increment the index of the leftmost unexplored node
+	}
+
+	return leg.comeBack // Stop here unless agent needs to go back to mark outgoing label as explored
+}
+
+// Walk is a walk of an agent as a state machine, for agents an Engine steps: each call to Next takes it a single step of time further
+// MoveUntil is a walk taken to the end in one go
+type Walk struct {
+	agent          *Agent
+	direction      Direction
+	destination    NodeID
+	toLastExplored bool // whether the walk goes on as long as the link ahead is explored, rather than to the destination
+	move           move // in progress, while moving
+	moving         bool
+	ended          bool
+	ok             bool // whether the agent made it alive
+	updateFound    bool
+}
+
+// Walk starts walking the agent in a direction until it reaches the given location, as MoveUntil does
+func (agent *Agent) Walk(direction Direction, id NodeID) *Walk {
+	walk := agent.walk(direction, id)
+	return &walk
+}
+
+// walk starts a walk to the given location, which the caller may keep on its stack
+func (agent *Agent) walk(direction Direction, id NodeID) Walk {
+	agent.trace(WalkStarted, agent.position.ID, id, agent.port(direction), unexplored)
+	return Walk{agent: agent, direction: direction, destination: id}
+}
+
+// WalkToLastExplored starts walking the agent in a direction as long as the link ahead is explored, as MoveToLastExplored does
+// Unlike it, the whiteboard of the node the walk ends on isn't left locked, and the walk doesn't show in traces
+func (agent *Agent) WalkToLastExplored(direction Direction) *Walk {
+	return &Walk{agent: agent, direction: direction, toLastExplored: true}
+}
+
+// over tells whether the walk is over once on a node, before moving on
+func (walk *Walk) over() bool {
+	agent := walk.agent
+	if !walk.toLastExplored {
+		return agent.Location() == walk.destination
+	}
+	agent.step(WhiteboardAction)
+	whiteboard := agent.current().whiteboard
+	whiteboard.Lock()
+	defer whiteboard.Unlock()
+	return whiteboard.label[agent.port(walk.direction)] != explored
+}
+
+// Next takes the walk further until the agent takes a step of time, and returns whether the walk is over instead
+func (walk *Walk) Next() bool {
+	for !walk.ended {
+		if !walk.moving {
+			if walk.over() {
+				walk.end(true, false)
+				break
+			}
+			walk.move, walk.moving = walk.agent.startMove(walk.agent.port(walk.direction)), true
+		}
+		if walk.move.next() {
+			return false
+		}
+		updateFound, err := walk.move.updateFound, walk.move.err
+		walk.moving = false
+		if err != nil || updateFound && !walk.toLastExplored { // on the way to the last explored link, an update is only read
+			walk.end(err == nil, updateFound)
+		}
+	}
+	return true
+}
+
+// Result returns, once the walk is over, whether the agent made it alive and whether it stopped on an update, as MoveUntil does
+func (walk *Walk) Result() (bool, bool) {
+	return walk.ok, walk.updateFound
+}
+
+// end ends the walk with its result
+func (walk *Walk) end(ok bool, updateFound bool) {
+	walk.ended, walk.ok, walk.updateFound = true, ok, updateFound
+	if !walk.toLastExplored {
+		walk.agent.trace(WalkEnded, walk.agent.position.ID, walk.agent.position.ID, None, unexplored)
+	}
+}
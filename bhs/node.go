@@ -8,4 +8,6 @@ type Node struct {
 	BlackHole  bool
 	ID         NodeID
 	whiteboard *Whiteboard
+	tokens     *Tokens   // nil unless agents can use tokens
+	grayHole   *grayHole // nil unless the node is a gray hole
 }
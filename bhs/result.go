@@ -0,0 +1,138 @@
+package bhs
+
+import "sync"
+
+// Fate is what became of an agent once the search is over
+type Fate uint8
+
+// Fates
+const (
+	Home      Fate = iota // 0: survived, and ended up on its homebase
+	Away                  // 1: survived somewhere else
+	Destroyed             // 2: by a black hole, a black link or a gray hole
+)
+
+// AgentResult is what a single agent did during a search
+type AgentResult struct {
+	Moves uint64
+	Fate  Fate
+}
+
+// Result is what a search found, and what it cost
+type Result struct {
+	BlackHole NodeID // located node, for searches of a single black hole
+	Homebase  NodeID // node the agent that located it counts from in an anonymous ring, see Ring.NodeAt
+	Moves     uint64 // total over every agent
+	Time      uint64 // ideal time
+	TeamSize  uint64 // agents that took part in the search
+	Destroyed uint64 // agents lost
+	Agents    []AgentResult
+	AllHome   bool // whether every surviving agent ended up on its homebase
+}
+
+// Team keeps track of the agents taking part in a search, to report on them once it is over
+// It is also a WaitGroup of the goroutines of the search: Add before starting one, and Done once it returns
+type Team struct {
+	sync.Mutex
+	sync.WaitGroup
+	agents    []*Agent
+	finished  []AgentResult // of the first agents, once they ran to the end with a SequentialScheduler, the team then lets them go
+	canceller canceller     // of the agents, nil unless the search runs with RunContext or their scheduler tells when they are over
+}
+
+// NewTeam helps construct a team with no agent yet
+func NewTeam() *Team {
+	return &Team{}
+}
+
+// NewAgent constructs an agent like NewAgent does, and adds it to the team
+func (team *Team) NewAgent(direction Direction, topology Topology, cautiousWalk bool, scheduler Scheduler) *Agent {
+	return team.add(NewAgent(direction, topology, cautiousWalk, scheduler))
+}
+
+// NewAgentAt constructs an agent like NewAgentAt does, and adds it to the team
+func (team *Team) NewAgentAt(direction Direction, topology Topology, cautiousWalk bool, scheduler Scheduler, homebaseNodeID NodeID) *Agent {
+	return team.add(NewAgentAt(direction, topology, cautiousWalk, scheduler, homebaseNodeID))
+}
+
+// Go runs the function in a goroutine of the team, or right away on the calling one with a SequentialScheduler
+// Agents that ran to the end then only take the room of their result, so millions of them fit in memory one after the other
+func (team *Team) Go(scheduler Scheduler, function func()) {
+	team.Add(1)
+	if _, sequential := scheduler.(*SequentialScheduler); !sequential {
+		go func() {
+			defer team.Done()
+			function()
+		}()
+		return
+	}
+
+	defer team.Done()
+	function()
+	team.Lock()
+	defer team.Unlock()
+	terminated := 0
+	for terminated < len(team.agents) && team.agents[terminated].terminated {
+		team.finished = append(team.finished, team.agents[terminated].result())
+		terminated++
+	}
+	team.agents = append(team.agents[:0], team.agents[terminated:]...)
+}
+
+func (team *Team) add(agent *Agent) *Agent {
+	team.Lock()
+	team.agents = append(team.agents, agent)
+	if agent.execution != nil {
+		team.canceller = agent.execution
+	} else if canceller, stops := agent.scheduler.(canceller); stops {
+		team.canceller = canceller
+	}
+	team.Unlock()
+	return agent
+}
+
+// Result reports on every agent of the team along with what the search found, from node 0
+// It first waits for every goroutine of the team to return, so none is left behind once the search is over
+func (team *Team) Result(blackHole NodeID, moves uint64, time uint64) Result {
+	return team.result(blackHole, 0, moves, time)
+}
+
+// ResultFrom reports like Result does, with the black hole located by the given agent, from its own homebase
+func (team *Team) ResultFrom(agent *Agent, blackHole NodeID, moves uint64, time uint64) Result {
+	return team.result(blackHole, agent.homebase, moves, time)
+}
+
+func (team *Team) result(blackHole NodeID, homebase NodeID, moves uint64, time uint64) Result {
+	team.Wait()
+	team.Lock()
+	defer team.Unlock()
+
+	agents := team.finished
+	for _, agent := range team.agents {
+		agents = append(agents, agent.result())
+	}
+	result := Result{blackHole, homebase, moves, time, uint64(len(agents)), 0, agents, true}
+	if result.Agents == nil {
+		result.Agents = []AgentResult{}
+	}
+	for _, agent := range result.Agents {
+		switch agent.Fate {
+		case Destroyed:
+			result.Destroyed++
+		case Away:
+			result.AllHome = false
+		}
+	}
+	return result
+}
+
+// result reports on what the agent did
+func (agent *Agent) result() AgentResult {
+	switch {
+	case !agent.Active:
+		return AgentResult{agent.Moves, Destroyed}
+	case agent.Location() != agent.HomebaseNodeID: // some algorithms move the homebase along
+		return AgentResult{agent.Moves, Away}
+	}
+	return AgentResult{agent.Moves, Home}
+}
@@ -1,39 +1,216 @@
 package bhs
 
+import "math/rand"
+
 // Ring defines the structure of a Ring network
-type Ring []*Node
+// Port Left leads to the next node, and port Right to the previous one, unless the ring is unoriented
+type Ring struct {
+	nodes     []*Node       // nil in a compact ring
+	compact   *compactNodes // nil unless the ring is compact
+	size      NodeID
+	swapped   []bool // nodes whose port labels are swapped, nil if the ring is oriented
+	anonymous bool   // whether node IDs are hidden from agents
+	blackLink []bool // nodes whose link to the next node destroys agents, nil if there is none
+	homebases []NodeID
+	delays    *delays    // nil if every link takes a single time unit to cross
+	grayHoles *grayHole  // nil unless black holes were turned into gray holes
+	tracing   *tracing   // nil unless a tracer follows the agents
+	execution *execution // nil unless the search runs with RunContext
+}
+
+// RingOption customizes the ring built by BuildRing
+type RingOption func(ring *Ring)
+
+// Unoriented randomly swaps the port labels of each node, so agents have no common sense of direction
+func Unoriented(seed int64) RingOption {
+	return func(ring *Ring) {
+		random := rand.New(rand.NewSource(seed))
+		ring.swapped = make([]bool, ring.size)
+		for id := range ring.swapped {
+			ring.swapped[id] = random.Intn(2) == 1
+		}
+	}
+}
+
+// Anonymous hides node IDs from agents, they count their location from their homebase instead
+func Anonymous() RingOption {
+	return func(ring *Ring) {
+		ring.anonymous = true
+	}
+}
+
+// Homebases sets the nodes agents may start from, instead of node 0 alone
+// They must differ from the black hole, and the links leading to each of them are labelled as explored
+func Homebases(ids ...NodeID) RingOption {
+	return func(ring *Ring) {
+		ring.homebases = ids
+	}
+}
+
+// BlackHoles turns more nodes into black holes, the homebase and IDs out of bounds are left untouched
+func BlackHoles(ids ...NodeID) RingOption {
+	return func(ring *Ring) {
+		for _, id := range ids {
+			if id != 0 && id < ring.size {
+				ring.Node(id).BlackHole = true
+			}
+		}
+	}
+}
+
+// RandomBlackHoles turns k more nodes, picked from the seed, into black holes
+// There are never more black holes than nodes other than the homebase
+func RandomBlackHoles(k int, seed int64) RingOption {
+	return func(ring *Ring) {
+		random := rand.New(rand.NewSource(seed))
+		for _, id := range random.Perm(int(ring.size)) {
+			if k == 0 {
+				return
+			}
+			if node := ring.lookup(NodeID(id)); id != 0 && (node == nil || !node.BlackHole) {
+				ring.Node(NodeID(id)).BlackHole = true
+				k--
+			}
+		}
+	}
+}
+
+// BlackLink turns the link between node id and the next one into a black link, which destroys agents crossing it
+// It replaces the black hole given to BuildRing, and any other option adds, so the ring has no black hole left
+func BlackLink(id NodeID) RingOption {
+	return func(ring *Ring) {
+		if id >= ring.size {
+			return
+		}
+		ring.blackLink = make([]bool, ring.size)
+		ring.blackLink[id] = true
+	}
+}
 
 // BuildRing creates a Ring network made of Nodes
 // Requires the position of the black hole, the number of nodes, and whether Nodes should include whiteboards
-// The ring is returned with an error if the black hole position is out of obunds
-func BuildRing(blackHoleID NodeID, len uint64, hasWhiteBoards bool) Ring {
+// Options apply before every node is allocated, so the ring may stay compact
+// An empty ring is returned if the black hole position is out of bounds
+func BuildRing(blackHoleID NodeID, len uint64, hasWhiteBoards bool, options ...RingOption) Ring {
 	ringSize := NodeID(len) // logically wrong, but needed for type correctness
 	if 0 > blackHoleID || blackHoleID >= ringSize {
-		return nil
+		return Ring{}
 	}
 
-	ring := make([]*Node, 0, ringSize)
+	ring := Ring{compact: &compactNodes{whiteboards: hasWhiteBoards}, size: ringSize, homebases: []NodeID{0}}
+	ring.Node(blackHoleID).BlackHole = true
 
-	for id := NodeID(0); id < ringSize; id++ {
-		var isBlackHole bool
-		if id == blackHoleID {
-			isBlackHole = true
+	for _, option := range options {
+		option(&ring)
+	}
+	if ring.blackLink != nil { // whether options adding black holes come before the black link or after it
+		for _, node := range ring.allocated() {
+			node.BlackHole, node.grayHole = false, nil
 		}
+		ring.grayHoles = nil
+	}
+	if !ring.compact.kept {
+		ring.nodes, ring.compact = ring.compact.expand(ringSize), nil
+	}
 
-		var whiteboard *Whiteboard
-		if hasWhiteBoards {
-			whiteboard = &Whiteboard{label: [2]ExploredType{unexplored, unexplored}, updateForAgent: None}
-
-			// set edge label to explored for the links to the homebase
-			if id == 1 {
-				whiteboard.label[Right] = explored // overwrite
-			} else if id == ringSize-1 {
-				whiteboard.label[Left] = explored // overwrite
+	// set edge label to explored for the links to the homebases, unless they are black
+	for _, homebase := range ring.homebases {
+		if hasWhiteBoards && homebase < ringSize {
+			for _, port := range []Direction{Left, Right} {
+				if !ring.isBlackLink(homebase, port) {
+					neighbour, back := ring.Neighbour(homebase, port)
+					ring.Node(neighbour).whiteboard.label[back] = explored
+				}
 			}
 		}
-
-		ring = append(ring, &Node{isBlackHole, id, whiteboard})
 	}
 
+	if ring.tracing != nil {
+		ring.tracing.follow(ring)
+	}
 	return ring
 }
+
+// Size returns the number of nodes in the ring
+func (ring Ring) Size() uint64 {
+	return uint64(ring.size)
+}
+
+// Node returns the node with the given ID, allocating it first in a compact ring
+func (ring Ring) Node(id NodeID) *Node {
+	if ring.compact != nil {
+		return ring.compact.node(id)
+	}
+	return ring.nodes[id]
+}
+
+// Ports returns the number of links of a node, which is always 2 in a ring
+func (ring Ring) Ports(id NodeID) int {
+	return 2
+}
+
+// Neighbour returns the node at the other end of a port, along with the port leading back
+func (ring Ring) Neighbour(id NodeID, port Direction) (NodeID, Direction) {
+	ringSize := ring.size
+	if ring.port(id, port) == Right {
+		previous := (id + ringSize - 1) % ringSize // go around the ring to previous node
+		return previous, ring.port(previous, Left)
+	}
+	next := (id + 1) % ringSize // go to next node
+	return next, ring.port(next, Right)
+}
+
+// Homebases returns the IDs of the nodes agents may start from
+func (ring Ring) Homebases() []NodeID {
+	return ring.homebases
+}
+
+// BlackHoles returns the IDs of the black holes of the ring, in increasing order
+func (ring Ring) BlackHoles() []NodeID {
+	var blackHoles []NodeID
+	for _, node := range ring.allocated() {
+		if node.BlackHole {
+			blackHoles = append(blackHoles, node.ID)
+		}
+	}
+	return blackHoles
+}
+
+// ReachableBlackHoles returns the IDs of the black holes agents can reach from the homebase, in increasing order
+// These are the first ones on each side of the homebase, any other black hole is hidden behind them
+func (ring Ring) ReachableBlackHoles() []NodeID {
+	blackHoles := ring.BlackHoles()
+	switch len(blackHoles) {
+	case 0, 1:
+		return blackHoles
+	}
+	return []NodeID{blackHoles[0], blackHoles[len(blackHoles)-1]}
+}
+
+// NodeAt returns the ID of the node at the location counted by agents from a homebase, when going through its Left port
+func (ring Ring) NodeAt(homebase NodeID, location NodeID) NodeID {
+	ringSize := ring.size
+	if ring.port(homebase, Left) == Right {
+		return (homebase + ringSize - location%ringSize) % ringSize
+	}
+	return (homebase + location) % ringSize
+}
+
+// isBlackLink returns whether the link behind a port of a node is black
+func (ring Ring) isBlackLink(id NodeID, port Direction) bool {
+	if ring.blackLink == nil {
+		return false
+	}
+	if ring.port(id, port) == Right {
+		id, _ = ring.Neighbour(id, port) // the link leaving the previous node to the left
+	}
+	return ring.blackLink[id]
+}
+
+// port converts a local port of a node to the global direction it leads to, and vice versa
+func (ring Ring) port(id NodeID, port Direction) Direction {
+	if ring.swapped != nil && ring.swapped[id] {
+		return GetOppositeDirection(port)
+	}
+	return port
+}
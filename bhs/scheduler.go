@@ -0,0 +1,170 @@
+package bhs
+
+import "sync"
+
+// Scheduler decides when agents are allowed to act
+type Scheduler interface {
+	Join(agent *Agent)
+	Leave(agent *Agent)
+	Start()
+	Step(agent *Agent, action Action)
+	Time() uint64
+}
+
+// Action is what an agent asks the scheduler to do next
+type Action uint8
+
+// Actions
+const (
+	MoveAction       Action = iota // 0
+	WhiteboardAction               // 1
+	TokenAction                    // 2
+	WaitAction                     // 3
+)
+
+// SynchronousScheduler makes agents advance in lockstep rounds
+// Every move or wait consumes one time unit, and a round only ends once every agent that joined the scheduler has moved or waited
+type SynchronousScheduler struct {
+	sync.Mutex
+	round   *sync.Cond
+	agents  map[*Agent]bool
+	started bool
+	waiting int
+	time    uint64
+	woken   bool // once the search is cancelled, agents no longer wait for rounds to end
+}
+
+// NewSynchronousScheduler helps construct a synchronous scheduler
+func NewSynchronousScheduler() *SynchronousScheduler {
+	scheduler := &SynchronousScheduler{agents: make(map[*Agent]bool)}
+	scheduler.round = sync.NewCond(scheduler)
+	return scheduler
+}
+
+// Join adds an agent to the rounds, it must then move (or leave) for any round to end
+func (scheduler *SynchronousScheduler) Join(agent *Agent) {
+	scheduler.Lock()
+	scheduler.agents[agent] = true
+	scheduler.Unlock()
+}
+
+// Leave removes an agent from the rounds, e.g. because it fell in the black hole or it is done moving
+func (scheduler *SynchronousScheduler) Leave(agent *Agent) {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	if !scheduler.agents[agent] {
+		return
+	}
+	delete(scheduler.agents, agent)
+	scheduler.advance()
+}
+
+// Start lets the first round begin, so agents joining before it all start at time 0
+func (scheduler *SynchronousScheduler) Start() {
+	scheduler.Lock()
+	scheduler.started = true
+	scheduler.advance()
+	scheduler.Unlock()
+}
+
+// Step blocks the agent until the current round ends, only moves and waits take time
+func (scheduler *SynchronousScheduler) Step(agent *Agent, action Action) {
+	if action != MoveAction && action != WaitAction {
+		return
+	}
+
+	scheduler.Lock()
+	defer scheduler.Unlock()
+
+	scheduler.waiting++
+	time := scheduler.time
+	scheduler.advance()
+	for scheduler.time == time && !scheduler.woken {
+		scheduler.round.Wait()
+	}
+}
+
+// wake lets every agent waiting for the round to end go, they stop as their search was cancelled
+func (scheduler *SynchronousScheduler) wake() {
+	scheduler.Lock()
+	scheduler.woken = true
+	scheduler.round.Broadcast()
+	scheduler.Unlock()
+}
+
+// Time returns the number of rounds completed so far
+func (scheduler *SynchronousScheduler) Time() uint64 {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	return scheduler.time
+}
+
+// advance ends the current round if every agent is waiting on it, must be called with the lock held
+func (scheduler *SynchronousScheduler) advance() {
+	if !scheduler.started || scheduler.waiting == 0 || scheduler.waiting < len(scheduler.agents) {
+		return
+	}
+	scheduler.waiting = 0
+	scheduler.time++
+	scheduler.round.Broadcast()
+}
+
+// SequentialScheduler runs agents one after the other, each with its own clock, so no agent needs a goroutine of its own
+// Agents a Team starts with Go run to the end right away, on the calling goroutine
+// Only agents that never wait for one another act as they do with the SynchronousScheduler, moves and waits take a time unit
+// Gray holes and link delays go by the order agents get somewhere, which running them one after the other changes
+type SequentialScheduler struct {
+	sync.Mutex
+	clocks  map[*Agent]uint64 // of the agents that joined and didn't leave yet
+	current *Agent            // the agent that acted last, nil once it left
+	time    uint64            // latest time any agent got to
+}
+
+// NewSequentialScheduler helps construct a sequential scheduler
+func NewSequentialScheduler() *SequentialScheduler {
+	return &SequentialScheduler{clocks: make(map[*Agent]uint64)}
+}
+
+// Join starts the agent's clock at 0
+func (scheduler *SequentialScheduler) Join(agent *Agent) {
+	scheduler.Lock()
+	scheduler.clocks[agent], scheduler.current = 0, agent
+	scheduler.Unlock()
+}
+
+// Leave forgets the agent's clock
+func (scheduler *SequentialScheduler) Leave(agent *Agent) {
+	scheduler.Lock()
+	delete(scheduler.clocks, agent)
+	if scheduler.current == agent {
+		scheduler.current = nil
+	}
+	scheduler.Unlock()
+}
+
+// Start does nothing, agents act as soon as they run
+func (scheduler *SequentialScheduler) Start() {}
+
+// Step lets the agent act right away, moves and waits move its clock on
+func (scheduler *SequentialScheduler) Step(agent *Agent, action Action) {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	scheduler.current = agent
+	if action != MoveAction && action != WaitAction {
+		return
+	}
+	scheduler.clocks[agent]++
+	if scheduler.clocks[agent] > scheduler.time {
+		scheduler.time = scheduler.clocks[agent]
+	}
+}
+
+// Time returns the clock of the agent acting, or the latest time any agent got to once it left
+func (scheduler *SequentialScheduler) Time() uint64 {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	if scheduler.current != nil {
+		return scheduler.clocks[scheduler.current]
+	}
+	return scheduler.time
+}
@@ -0,0 +1,165 @@
+package bhs
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Colours of the agents of a space-time diagram, in turn
+var spaceTimeColours = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#9467bd", "#8c564b", "#e377c2", "#17becf", "#bcbd22"}
+
+// spaceTimePoint is where an agent was at a given time
+type spaceTimePoint struct {
+	time uint64
+	x    float64 // node ID, or a node beyond the ends of the axis while wrapping around the ring
+}
+
+// spaceTimeMark is a death or whiteboard update shown on a space-time diagram
+type spaceTimeMark struct {
+	time  uint64
+	x     float64
+	kind  EventKind
+	agent uint64
+}
+
+// SpaceTime collects events to draw the space-time diagram of a run as an SVG: node IDs go left to right, and time goes down
+// Each agent's trajectory is a polyline, deaths are red crosses and whiteboard updates are annotated diamonds
+// The column of the node the search reported as the black hole is shaded, once Found tells it
+type SpaceTime struct {
+	sync.Mutex
+	ringSize     NodeID
+	trajectories map[uint64][][]spaceTimePoint // polylines of each agent, a new one starts whenever it wraps around the ring
+	agents       []uint64                      // in the order they spawned
+	marks        []spaceTimeMark
+	time         uint64
+	found        NodeID
+	hasFound     bool
+}
+
+// NewSpaceTime helps construct a space-time diagram of a ring of the given size
+func NewSpaceTime(ringSize uint64) *SpaceTime {
+	return &SpaceTime{ringSize: NodeID(ringSize), trajectories: make(map[uint64][][]spaceTimePoint)}
+}
+
+// Trace extends the trajectory of the agent, or marks where it was destroyed or left an update
+func (spaceTime *SpaceTime) Trace(event Event) {
+	spaceTime.Lock()
+	defer spaceTime.Unlock()
+	if event.Time > spaceTime.time {
+		spaceTime.time = event.Time
+	}
+
+	switch event.Kind {
+	case AgentSpawned:
+		spaceTime.agents = append(spaceTime.agents, event.Agent)
+		spaceTime.trajectories[event.Agent] = [][]spaceTimePoint{{{event.Time, float64(event.Node)}}}
+	case AgentMoved:
+		polylines := spaceTime.trajectories[event.Agent]
+		polyline := polylines[len(polylines)-1]
+		departure := polyline[len(polyline)-1].time
+		if event.Time > departure+1 { // the agent waited on the node before moving
+			departure = event.Time - 1
+			polyline = append(polyline, spaceTimePoint{departure, float64(event.Node)})
+		}
+
+		to := float64(event.To)
+		switch {
+		case event.Node == spaceTime.ringSize-1 && event.To == 0: // wraps around to the next node
+			polylines[len(polylines)-1] = append(polyline, spaceTimePoint{event.Time, float64(spaceTime.ringSize)})
+			polylines = append(polylines, []spaceTimePoint{{departure, -1}, {event.Time, to}})
+		case event.Node == 0 && event.To == spaceTime.ringSize-1: // wraps around to the previous node
+			polylines[len(polylines)-1] = append(polyline, spaceTimePoint{event.Time, -1})
+			polylines = append(polylines, []spaceTimePoint{{departure, float64(spaceTime.ringSize)}, {event.Time, to}})
+		default:
+			polylines[len(polylines)-1] = append(polyline, spaceTimePoint{event.Time, to})
+		}
+		spaceTime.trajectories[event.Agent] = polylines
+	case AgentDestroyed:
+		x := float64(event.Node)
+		switch { // in the middle of a black link
+		case event.To+1 == event.Node || event.Node+1 == event.To:
+			x = (x + float64(event.To)) / 2
+		case event.To != event.Node:
+			x = float64(spaceTime.ringSize) - 0.5 // between the last node and node 0
+		}
+		spaceTime.marks = append(spaceTime.marks, spaceTimeMark{event.Time, x, event.Kind, event.Agent})
+	case UpdateWritten, UpdateRead:
+		spaceTime.marks = append(spaceTime.marks, spaceTimeMark{event.Time, float64(event.Node), event.Kind, event.Agent})
+	case AgentTerminated:
+		polylines := spaceTime.trajectories[event.Agent]
+		polylines[len(polylines)-1] = append(polylines[len(polylines)-1], spaceTimePoint{event.Time, float64(event.Node)})
+	}
+}
+
+// Found marks the node the search reported as the black hole
+func (spaceTime *SpaceTime) Found(blackHole NodeID) {
+	spaceTime.Lock()
+	defer spaceTime.Unlock()
+	spaceTime.found, spaceTime.hasFound = blackHole, true
+}
+
+// WriteTo writes the diagram of the events collected so far as an SVG
+func (spaceTime *SpaceTime) WriteTo(writer io.Writer) (int64, error) {
+	spaceTime.Lock()
+	defer spaceTime.Unlock()
+
+	// about 800 pixels wide and at most 1200 high, whatever the size of the ring and the time the search took
+	dx := 800 / float64(spaceTime.ringSize+2)
+	dy := 1200 / float64(spaceTime.time+1)
+	if dy > 12 {
+		dy = 12
+	}
+	const margin = 50
+	x := func(node float64) float64 { return margin + (node+1)*dx }
+	y := func(time uint64) float64 { return margin + float64(time)*dy }
+	width, height := x(float64(spaceTime.ringSize))+margin, y(spaceTime.time)+margin
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" font-family="sans-serif" font-size="10">`+"\n", width, height)
+	fmt.Fprintf(&svg, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+
+	if spaceTime.hasFound {
+		fmt.Fprintf(&svg, `<rect x="%.1f" y="%d" width="%.1f" height="%.1f" fill="#fdd"><title>black hole found</title></rect>`+"\n", x(float64(spaceTime.found))-dx/2, margin, dx, y(spaceTime.time)-margin)
+	}
+
+	// axes, with about 10 ticks each
+	fmt.Fprintf(&svg, `<text x="%.1f" y="15" text-anchor="middle">node ID</text>`+"\n", width/2)
+	fmt.Fprintf(&svg, `<text x="15" y="%.1f" transform="rotate(-90 15 %.1f)" text-anchor="middle">time</text>`+"\n", height/2, height/2)
+	nodeTicks := spaceTime.ringSize/10 + 1
+	for node := NodeID(0); node < spaceTime.ringSize; node += nodeTicks {
+		fmt.Fprintf(&svg, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.1f" stroke="#ddd"/>`+"\n", x(float64(node)), margin, x(float64(node)), y(spaceTime.time))
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%d" text-anchor="middle">%d</text>`+"\n", x(float64(node)), margin-8, node)
+	}
+	timeTicks := spaceTime.time/10 + 1
+	for time := uint64(0); time <= spaceTime.time; time += timeTicks {
+		fmt.Fprintf(&svg, `<text x="%d" y="%.1f" text-anchor="end">%d</text>`+"\n", margin-8, y(time)+3, time)
+	}
+
+	for i, agent := range spaceTime.agents {
+		colour := spaceTimeColours[i%len(spaceTimeColours)]
+		for _, polyline := range spaceTime.trajectories[agent] {
+			var points []string
+			for _, point := range polyline {
+				points = append(points, fmt.Sprintf("%.1f,%.1f", x(point.x), y(point.time)))
+			}
+			fmt.Fprintf(&svg, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"><title>agent %d</title></polyline>`+"\n", strings.Join(points, " "), colour, agent)
+		}
+	}
+
+	for _, mark := range spaceTime.marks {
+		markX, markY := x(mark.x), y(mark.time)
+		if mark.kind == AgentDestroyed {
+			fmt.Fprintf(&svg, `<path d="M%.1f,%.1f l8,8 m0,-8 l-8,8" stroke="red" stroke-width="2"><title>agent %d destroyed at time %d</title></path>`+"\n", markX-4, markY-4, mark.agent, mark.time)
+			continue
+		}
+		annotation := map[EventKind]string{UpdateWritten: "update", UpdateRead: "read"}[mark.kind]
+		fmt.Fprintf(&svg, `<path d="M%.1f,%.1f l4,4 l-4,4 l-4,-4 z" fill="black"><title>agent %d, %s at time %d</title></path>`+"\n", markX, markY-4, mark.agent, mark.kind, mark.time)
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f">%s</text>`+"\n", markX+6, markY+3, annotation)
+	}
+	svg.WriteString("</svg>\n")
+
+	written, err := io.WriteString(writer, svg.String())
+	return int64(written), err
+}
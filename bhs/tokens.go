@@ -0,0 +1,113 @@
+package bhs
+
+import (
+	"fmt"
+	"sync"
+)
+
+// TokenColor tells tokens apart, tokens of the same color are indistinguishable
+type TokenColor uint8
+
+// Token colors used by the token cautious walk, algorithms are free to use any other
+const (
+	LeftCautionToken  TokenColor = iota // 0: dropped before crossing an unexplored link to the left
+	RightCautionToken                   // 1: dropped before crossing an unexplored link to the right
+)
+
+// Tokens is the pile of tokens lying on a node
+type Tokens struct {
+	sync.Mutex
+	count map[TokenColor]uint64
+}
+
+// WithTokens lets agents drop and pick up tokens on every node of the ring
+// Without whiteboards, agents then use tokens for cautious walk
+func WithTokens() RingOption {
+	return func(ring *Ring) {
+		ring.compact.tokens = true
+		for _, node := range ring.allocated() {
+			node.tokens = newTokens()
+		}
+	}
+}
+
+// newTokens creates an empty pile of tokens
+func newTokens() *Tokens {
+	return &Tokens{count: make(map[TokenColor]uint64)}
+}
+
+// DropToken leaves a token of the given color on the node the agent is on
+func (agent *Agent) DropToken(color TokenColor) error {
+	tokens := agent.writable().tokens
+	if tokens == nil {
+		return fmt.Errorf("no tokens in this network")
+	}
+	agent.step(TokenAction)
+	tokens.Lock()
+	tokens.count[color]++
+	tokens.Unlock()
+	return nil
+}
+
+// PickToken takes a token of the given color from the node the agent is on
+func (agent *Agent) PickToken(color TokenColor) error {
+	tokens := agent.current().tokens // tokens to pick up are only on nodes already written on
+	if tokens == nil {
+		return fmt.Errorf("no tokens in this network")
+	}
+	agent.step(TokenAction)
+	tokens.Lock()
+	defer tokens.Unlock()
+	if tokens.count[color] == 0 {
+		return fmt.Errorf("no token to pick up")
+	}
+	tokens.count[color]--
+	return nil
+}
+
+// CountTokens returns the number of tokens of the given color on the node the agent is on
+func (agent *Agent) CountTokens(color TokenColor) uint64 {
+	tokens := agent.current().tokens
+	if tokens == nil {
+		return 0
+	}
+	agent.step(TokenAction)
+	tokens.Lock()
+	defer tokens.Unlock()
+	return tokens.count[color]
+}
+
+// dropCautionToken starts a token cautious walk through a port, if the node behind it is unexplored
+// Returns whether a token was dropped, in which case the agent must come back to pick it up once the node is known to be safe
+// It is busy, and drops nothing, while another agent's token tells that the link is being explored
+func (agent *Agent) dropCautionToken(port Direction) (dropped bool, busy bool, err error) {
+	if !agent.unexplored(agent.locationThrough(port)) { // already explored, nothing to fear
+		return false, false, nil
+	}
+
+	tokens, color := agent.writable().tokens, cautionToken(agent, port)
+	if tokens == nil {
+		return false, false, fmt.Errorf("no tokens in this network")
+	}
+	agent.step(TokenAction)
+	tokens.Lock()
+	defer tokens.Unlock()
+	if tokens.count[color] > 0 {
+		return false, true, nil
+	}
+	tokens.count[color]++
+	return true, false, nil
+}
+
+// pickCautionToken ends a token cautious walk through a port, once back on the node the token was dropped on
+func (agent *Agent) pickCautionToken(port Direction) error {
+	return agent.PickToken(cautionToken(agent, port))
+}
+
+// cautionToken returns the color of the token dropped before crossing a link, from the agent's sense of direction
+func cautionToken(agent *Agent, port Direction) TokenColor {
+	if port == agent.port(Left) {
+		return LeftCautionToken
+	}
+	return RightCautionToken
+}
@@ -0,0 +1,176 @@
+package bhs
+
+import "fmt"
+
+// Topology is a network agents move around
+// Nodes are identified from 0 to Size()-1, and the links of each node by port numbers from 0 to Ports(id)-1
+type Topology interface {
+	Size() uint64
+	Node(id NodeID) *Node
+	Ports(id NodeID) int
+	Neighbour(id NodeID, port Direction) (NodeID, Direction)
+}
+
+// Graph is an arbitrary port-labelled network
+type Graph struct {
+	nodes []*Node
+	links [][]link
+}
+
+// link is the end of a link, seen from the node it leaves
+type link struct {
+	to   NodeID
+	back Direction // port of the destination leading back
+}
+
+// BuildGraph creates a Graph network made of Nodes
+// Port i of node id leads to adjacency[id][i], and every link must be listed at both of its ends
+// Links to the homebase, node 0, are labelled as explored like in a ring
+// An empty graph is returned if the black hole position is out of bounds or a link is listed at one end only
+func BuildGraph(blackHoleID NodeID, adjacency [][]NodeID, hasWhiteBoards bool) Graph {
+	graphSize := NodeID(len(adjacency))
+	if blackHoleID >= graphSize {
+		return Graph{}
+	}
+
+	nodes := make([]*Node, 0, graphSize)
+	links := make([][]link, graphSize)
+	for id := NodeID(0); id < graphSize; id++ {
+		links[id] = make([]link, len(adjacency[id]))
+		for port, neighbour := range adjacency[id] {
+			back, ok := portTo(adjacency, neighbour, id, countPortsBefore(adjacency[id], port))
+			if neighbour >= graphSize || !ok {
+				return Graph{}
+			}
+			links[id][port] = link{neighbour, back}
+		}
+
+		var whiteboard *Whiteboard
+		if hasWhiteBoards {
+			whiteboard = newWhiteboard(len(adjacency[id]))
+		}
+		nodes = append(nodes, &Node{id == blackHoleID, id, whiteboard, nil, nil})
+	}
+
+	// set edge label to explored for the links to the homebase
+	if hasWhiteBoards {
+		for _, link := range links[0] {
+			nodes[link.to].whiteboard.label[link.back] = explored
+		}
+	}
+
+	return Graph{nodes, links}
+}
+
+// BuildTorus creates a torus of rows by columns nodes, node id sits in row id/columns and column id%columns
+// Ports 0 and 1 lead to the next and previous columns (like Left and Right in a ring), ports 2 and 3 to the next and previous rows
+func BuildTorus(blackHoleID NodeID, rows, columns uint64, hasWhiteBoards bool) Graph {
+	adjacency := make([][]NodeID, rows*columns)
+	for row := uint64(0); row < rows; row++ {
+		for column := uint64(0); column < columns; column++ {
+			adjacency[row*columns+column] = []NodeID{
+				NodeID(row*columns + (column+1)%columns),
+				NodeID(row*columns + (column+columns-1)%columns),
+				NodeID((row+1)%rows*columns + column),
+				NodeID((row+rows-1)%rows*columns + column),
+			}
+		}
+	}
+	return BuildGraph(blackHoleID, adjacency, hasWhiteBoards)
+}
+
+// BuildHypercube creates a hypercube of the given dimension, port i flips bit i of the node ID
+func BuildHypercube(blackHoleID NodeID, dimension uint, hasWhiteBoards bool) Graph {
+	adjacency := make([][]NodeID, 1<<dimension)
+	for id := range adjacency {
+		for bit := uint(0); bit < dimension; bit++ {
+			adjacency[id] = append(adjacency[id], NodeID(id^(1<<bit)))
+		}
+	}
+	return BuildGraph(blackHoleID, adjacency, hasWhiteBoards)
+}
+
+// BuildTree creates a tree rooted at node 0, where parents[id] is the parent of node id (parents[0] is ignored)
+// Port 0 leads to the parent, then the following ports lead to the children in increasing ID order
+// Returns an error unless every node leads up to the root through its parents, and the black hole is in the tree
+func BuildTree(blackHoleID NodeID, parents []NodeID, hasWhiteBoards bool) (Graph, error) {
+	treeSize := NodeID(len(parents))
+	if blackHoleID >= treeSize {
+		return Graph{}, fmt.Errorf("black hole %d out of a tree of %d nodes", blackHoleID, treeSize)
+	}
+	rooted := make([]bool, treeSize) // nodes known to lead up to the root
+	if treeSize > 0 {
+		rooted[0] = true
+	}
+	for id := NodeID(1); id < treeSize; id++ {
+		path := []NodeID{}
+		for ancestor := id; !rooted[ancestor]; ancestor = parents[ancestor] {
+			if parents[ancestor] >= treeSize {
+				return Graph{}, fmt.Errorf("parent %d of node %d out of the tree", parents[ancestor], ancestor)
+			}
+			if len(path) == int(treeSize) {
+				return Graph{}, fmt.Errorf("node %d is in a cycle of parents", ancestor)
+			}
+			path = append(path, ancestor)
+		}
+		for _, ancestor := range path {
+			rooted[ancestor] = true
+		}
+	}
+
+	adjacency := make([][]NodeID, treeSize)
+	for id := 1; id < len(parents); id++ {
+		adjacency[id] = append([]NodeID{parents[id]}, adjacency[id]...)
+		adjacency[parents[id]] = append(adjacency[parents[id]], NodeID(id))
+	}
+	return BuildGraph(blackHoleID, adjacency, hasWhiteBoards), nil
+}
+
+// Size returns the number of nodes in the graph
+func (graph Graph) Size() uint64 {
+	return uint64(len(graph.nodes))
+}
+
+// Node returns the node with the given ID
+func (graph Graph) Node(id NodeID) *Node {
+	return graph.nodes[id]
+}
+
+// Ports returns the number of links of a node
+func (graph Graph) Ports(id NodeID) int {
+	return len(graph.links[id])
+}
+
+// Neighbour returns the node at the other end of a port, along with the port leading back
+func (graph Graph) Neighbour(id NodeID, port Direction) (NodeID, Direction) {
+	link := graph.links[id][port]
+	return link.to, link.back
+}
+
+// countPortsBefore counts the ports before the given one that lead to the same node, to pair up parallel links
+func countPortsBefore(ports []NodeID, port int) int {
+	count := 0
+	for i := 0; i < port; i++ {
+		if ports[i] == ports[port] {
+			count++
+		}
+	}
+	return count
+}
+
+// portTo returns the port of node id leading to node to, skipping the first parallel links
+func portTo(adjacency [][]NodeID, id NodeID, to NodeID, parallel int) (Direction, bool) {
+	if id >= NodeID(len(adjacency)) {
+		return 0, false
+	}
+	for port, neighbour := range adjacency[id] {
+		if neighbour != to {
+			continue
+		}
+		if parallel == 0 {
+			return Direction(port), true
+		}
+		parallel--
+	}
+	return 0, false
+}
@@ -0,0 +1,165 @@
+package bhs
+
+import "sync"
+
+// Tracer receives an event for everything agents do on a ring, one at a time and in the order they happen
+type Tracer interface {
+	Trace(event Event)
+}
+
+// EventKind tells what an agent did
+type EventKind uint8
+
+// Event kinds
+const (
+	AgentSpawned    EventKind = iota // 0: Node is the homebase
+	AgentMoved                       // 1: from Node to To, through Port
+	LabelChanged                     // 2: the link behind Port of Node is now labelled Label
+	UpdateWritten                    // 3: on the whiteboard of Node, for the agent exploring the ring through Port
+	UpdateRead                       // 4: from the whiteboard of Node
+	AgentDestroyed                   // 5: on Node, or on the link to To if it is a black link
+	AgentTerminated                  // 6: on Node, the agent won't act anymore
+	WalkStarted                      // 7: MoveUntil from Node through Port, until To as the agent counts it
+	WalkEnded                        // 8: MoveUntil stopped on Node, arrived or not
+)
+
+var eventKinds = [...]string{"spawned", "moved", "label_changed", "update_written", "update_read", "destroyed", "terminated", "walk_started", "walk_ended"}
+
+func (kind EventKind) String() string {
+	if int(kind) < len(eventKinds) {
+		return eventKinds[kind]
+	}
+	return "unknown"
+}
+
+func (label ExploredType) String() string {
+	switch label {
+	case unexplored:
+		return "unexplored"
+	case active:
+		return "active"
+	case explored:
+		return "explored"
+	}
+	return "unknown"
+}
+
+// Event is something an agent did, nodes are given by their actual IDs even in anonymous rings
+type Event struct {
+	Kind       EventKind
+	Sequence   uint64 // logical timestamp, the events of a ring are numbered from 0 in the order they happen
+	Time       uint64 // time of the scheduler when it happened, 0 without a scheduler
+	Agent      uint64 // agents are numbered from 0 in the order they spawn on the ring
+	Node       NodeID
+	To         NodeID
+	Port       Direction // local port of Node, None if the event doesn't go through one
+	Direction  Direction // the port's direction around the ring, Left towards the next node, whatever the port labels
+	Label      ExploredType
+	Unexplored [2]NodeID // unexplored set of the update written or read, as the agent counts it
+}
+
+// tracing numbers the events and agents of a ring, and hands events to its tracers
+type tracing struct {
+	sync.Mutex
+	tracers  []Tracer
+	sequence uint64
+	agents   uint64
+	emitted  uint64           // events handed to the tracers so far
+	pending  map[uint64]Event // numbered but held back until the events before them are emitted, by sequence
+}
+
+// ringFollower is a tracer that needs to know the ring it traces, e.g. to check events against its black holes
+type ringFollower interface {
+	follow(ring Ring)
+}
+
+// WithTracer hands every event of the ring to the tracer, along with the tracers given before
+func WithTracer(tracer Tracer) RingOption {
+	return func(ring *Ring) {
+		if ring.tracing == nil {
+			ring.tracing = &tracing{}
+		}
+		ring.tracing.tracers = append(ring.tracing.tracers, tracer)
+	}
+}
+
+// follow lets the tracers of a ring that need to know it follow it, once it is built
+func (tracing *tracing) follow(ring Ring) {
+	for _, tracer := range tracing.tracers {
+		if follower, ok := tracer.(ringFollower); ok {
+			follower.follow(ring)
+		}
+	}
+}
+
+// TracerFunc turns a function into a Tracer
+type TracerFunc func(event Event)
+
+// Trace calls the function
+func (tracerFunc TracerFunc) Trace(event Event) {
+	tracerFunc(event)
+}
+
+// trace hands an event of the agent to the tracers of its ring, if any
+func (agent *Agent) trace(kind EventKind, node NodeID, to NodeID, port Direction, label ExploredType) {
+	agent.event(kind, node, to, port, label).emit()
+}
+
+// traced is an event numbered while the agent may hold a whiteboard lock, to hand to the tracers once it let go of it
+type traced struct {
+	tracing *tracing // nil if the ring has no tracer
+	event   Event
+}
+
+// event numbers an event of the agent, for emit to hand to the tracers of its ring
+// Agents spawning get their number here, so it must come first
+func (agent *Agent) event(kind EventKind, node NodeID, to NodeID, port Direction, label ExploredType) traced {
+	ring, onRing := agent.topology.(Ring)
+	if !onRing || ring.tracing == nil {
+		return traced{}
+	}
+
+	tracing := ring.tracing
+	tracing.Lock()
+	defer tracing.Unlock()
+	var time uint64
+	if agent.scheduler != nil { // read along with the sequence, so that events numbered later never happen earlier
+		time = agent.scheduler.Time()
+	}
+	if kind == AgentSpawned {
+		agent.id = tracing.agents
+		tracing.agents++
+	}
+	direction := port
+	if port != None {
+		direction = ring.port(node, port)
+	}
+	var unexplored [2]NodeID
+	if kind == UpdateWritten || kind == UpdateRead { // the agent's unexplored set is the update's by then
+		unexplored = agent.UnexploredSet
+	}
+	tracing.sequence++
+	return traced{tracing, Event{kind, tracing.sequence - 1, time, agent.id, node, to, port, direction, label, unexplored}}
+}
+
+// emit hands the event to the tracers, after every event numbered before it
+// An event numbered first but not emitted yet holds the next ones back, so tracers still get them in order
+func (traced traced) emit() {
+	tracing := traced.tracing
+	if tracing == nil {
+		return
+	}
+	tracing.Lock()
+	defer tracing.Unlock()
+	if tracing.pending == nil {
+		tracing.pending = make(map[uint64]Event)
+	}
+	tracing.pending[traced.event.Sequence] = traced.event
+	for event, ok := tracing.pending[tracing.emitted]; ok; event, ok = tracing.pending[tracing.emitted] {
+		delete(tracing.pending, tracing.emitted)
+		tracing.emitted++
+		for _, tracer := range tracing.tracers {
+			tracer.Trace(event)
+		}
+	}
+}
@@ -1,21 +1,77 @@
 package bhs
 
-import "sync"
+import (
+	"fmt"
+	"sync"
+)
 
 // Whiteboard is an abstraction of the sync.Map structure
 type Whiteboard struct {
 	sync.Mutex
-	label          [2]ExploredType
+	label          []ExploredType // one per port
 	updateForAgent Direction
 	unexploredSet  [2]NodeID
 	actAsSmall     bool
 	homebaseNodeID NodeID
+	marks          map[Mark]uint64 // written by algorithms of their own, nil until the first one is
+}
+
+// newWhiteboard creates a whiteboard where the links of all ports are unexplored
+func newWhiteboard(ports int) *Whiteboard {
+	return &Whiteboard{label: make([]ExploredType, ports), updateForAgent: None}
+}
+
+// Mark tells apart the marks agents write on whiteboards, marks of the same kind are indistinguishable
+type Mark uint8
+
+// WriteMark writes a mark of the given kind on the whiteboard of the node the agent is on
+func (agent *Agent) WriteMark(mark Mark) error {
+	whiteboard := agent.writable().whiteboard
+	if whiteboard == nil {
+		return fmt.Errorf("no whiteboards in this network")
+	}
+	agent.step(WhiteboardAction)
+	whiteboard.Lock()
+	defer whiteboard.Unlock()
+	if whiteboard.marks == nil {
+		whiteboard.marks = make(map[Mark]uint64)
+	}
+	whiteboard.marks[mark]++
+	return nil
+}
+
+// EraseMark erases a mark of the given kind from the whiteboard of the node the agent is on
+func (agent *Agent) EraseMark(mark Mark) error {
+	whiteboard := agent.current().whiteboard // marks to erase are only on nodes already written on
+	if whiteboard == nil {
+		return fmt.Errorf("no whiteboards in this network")
+	}
+	agent.step(WhiteboardAction)
+	whiteboard.Lock()
+	defer whiteboard.Unlock()
+	if whiteboard.marks[mark] == 0 {
+		return fmt.Errorf("no mark to erase")
+	}
+	whiteboard.marks[mark]--
+	return nil
+}
+
+// CountMarks returns the number of marks of the given kind on the whiteboard of the node the agent is on
+func (agent *Agent) CountMarks(mark Mark) uint64 {
+	whiteboard := agent.current().whiteboard
+	if whiteboard == nil {
+		return 0
+	}
+	agent.step(WhiteboardAction)
+	whiteboard.Lock()
+	defer whiteboard.Unlock()
+	return whiteboard.marks[mark]
 }
 
 // ExploredType is used for cautious walk for edge labels
 type ExploredType uint8
 
-// Direction is used for left and right
+// Direction is used for left and right, and more generally for the port numbers of a node
 type Direction uint8
 
 // Directions
@@ -1,8 +1,15 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"./bhs/algorithms"
 	"./helpers"
@@ -17,46 +24,259 @@ type measures struct {
 	average uint64
 }
 type statistics struct {
-	move measures
-	time measures
+	move      measures
+	time      measures
+	team      measures
+	destroyed measures
+	memory    measures // bytes allocated to build the ring and search it
+	home      uint64   // runs where every surviving agent ended up at its homebase
 }
-type blackHoleSearchAlgorithm struct {
-	algorithmName string
-	algorithm     func(bhs.Ring) (bhs.NodeID, uint64, uint64)
-	hasWhiteBoard bool
+
+// add records the value measured for a black hole, the first one sets the minimum
+func (measures *measures) add(value uint64, first bool) {
+	if first {
+		measures.min = value
+	}
+	measures.min, measures.max = helpers.MinUint64(measures.min, value), helpers.MaxUint64(measures.max, value)
+	measures.average += value
 }
 
+// byteSize formats a number of bytes with binary units, e.g. 1.5 MiB
+func byteSize(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, exponent := float64(n)/unit, 0
+	for ; size >= unit && exponent < 5; exponent++ {
+		size /= unit
+	}
+	return fmt.Sprintf("%.1f %ciB", size, "KMGTPE"[exponent])
+}
+
+// policies are the adversarial scheduling policies available from the command line
+var policies = map[string]bhs.Policy{
+	"random":     bhs.RandomPolicy,
+	"roundrobin": bhs.RoundRobinPolicy,
+	"starve":     bhs.StarvePolicy,
+	"nearbh":     bhs.NearBlackHolePolicy,
+}
+
+// report is where runs are reported, stderr when the trace mode writes to stdout
+var report io.Writer = os.Stdout
+
+// hung tells whether a search was given up on past the timeout, main then exits with status 1
+var hung bool
+
+// timeout is how long a single search may take, 0 for ever
+var timeout time.Duration
+
 func main() {
 
 	var ringSize, blackHoleNodeID uint64
-	var runAlgorithm int
+	var runAlgorithm, blackHoles, runs int
+	var policy, engine, homebases, delays, out, format, dot string
+	var maxDelay uint64
+	var seed int64
+	var grayHole float64
+	var grayEvery uint64
+	var frame time.Duration
+	var unoriented, anonymous, blackLink, check, compact bool
 	var help bool
 	flag.Uint64Var(&ringSize, "ringSize", 100, "pass the value of the desired ring size... like so: go run main.go -ringSize 100")
-	flag.IntVar(&runAlgorithm, "alg", 100, "100: run all with stats\n\t0: Divide\n\t1: Group\n\t2: OptAvgTime\n\t3: OptTeamSize\n\t4: OptTime")
+	flag.IntVar(&runAlgorithm, "alg", 100, "100: run all with stats"+algorithmList("\n\t"))
 	flag.Uint64Var(&blackHoleNodeID, "bh", 1, "must be used with alg flag")
+	flag.IntVar(&blackHoles, "k", 1, "number of black holes, more than 1 runs ShadowPairs (must be used with bh flag)")
+	flag.BoolVar(&blackLink, "blackLink", false, "the link between node bh and the next one destroys agents instead of node bh, runs BlackLinkPairs")
+	flag.Float64Var(&grayHole, "grayHole", 0, "probability that the hole at bh destroys an arriving agent, using the seed (0 for a black hole)")
+	flag.Uint64Var(&grayEvery, "grayEvery", 0, "the hole at bh only destroys every k-th arriving agent (0 for a black hole)")
+	flag.StringVar(&homebases, "homebases", "", "comma-separated nodes agents start from, runs Scattered (must be used with bh flag)")
+	flag.StringVar(&delays, "delays", "unit", "unit, constant, random (using the seed) or adversarial link delays")
+	flag.Uint64Var(&maxDelay, "maxDelay", 3, "time units it takes to cross a link, at most, with the delays flag")
+	flag.StringVar(&policy, "policy", "sync", "sync: agents move in lockstep rounds\n\tsequential: agents of algorithms where they never wait for one another run one after the other, without a goroutine each\n\trandom, roundrobin, starve or nearbh: adversarial scheduling")
+	flag.StringVar(&engine, "engine", "goroutines", "goroutines: each agent runs on a goroutine of its own\n\tevents: agents written as state machines are stepped by an event loop on a single goroutine, with the sync policy")
+	flag.Int64Var(&seed, "seed", 1, "seed of the adversarial scheduling policy")
+	flag.BoolVar(&unoriented, "unoriented", false, "randomly swap the port labels of each node, using the seed")
+	flag.BoolVar(&anonymous, "anonymous", false, "hide node IDs from agents")
+	flag.BoolVar(&compact, "compact", false, "only allocate the nodes of the ring agents need, for rings of millions of nodes")
+	flag.StringVar(&out, "out", "", "file the trace mode writes to, stdout if empty")
+	flag.StringVar(&format, "format", "jsonl", "jsonl: the trace mode writes a JSON object per line\n\tchrome: the trace mode writes a Chrome trace, for Perfetto\n\tsvg: the trace mode draws a space-time diagram")
+	flag.BoolVar(&check, "check", false, "check the invariants of cautious walk as agents go, and exit with status 1 if any is violated")
+	flag.StringVar(&dot, "dot", "", "file the state of the ring is written to as a DOT graph, once a single algorithm ran")
+	flag.DurationVar(&frame, "frame", 100*time.Millisecond, "how long the animate mode shows each time unit")
+	flag.IntVar(&runs, "runs", 100000, "most runs the modelcheck mode tries for each black hole")
+	flag.DurationVar(&timeout, "timeout", time.Minute, "how long a single search may take before it is given up on, 0 for ever")
 	flag.BoolVar(&help, "help", false, "-help")
-	flag.Parse()
+
+	// go run main.go trace|animate|modelcheck [flags] runs a single search, and traces, animates or model checks it
+	args, mode := os.Args[1:], ""
+	if len(args) > 0 && (args[0] == "trace" || args[0] == "animate" || args[0] == "modelcheck") {
+		mode, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
 
 	if help {
-		fmt.Println("Running without any flags will default to -ringSize 100 -alg 0")
+		fmt.Println("Running without any flags will default to -ringSize 100 -alg 100")
 		fmt.Println("\nUsage:")
-		fmt.Println("\t-alg\n\t\t0: run all\n\t\t1: Divide\n\t\t2: Group\n\t\t3: OptAvgTime\n\t\t4: OptTeamSize\n\t\t5: OptTime")
+		fmt.Println("\ttrace\n\t\tas the first argument, runs a single search and writes every agent action as a line of JSON, e.g. go run main.go trace -alg 3 -bh 7 -out run.jsonl")
+		fmt.Println("\tanimate\n\t\tas the first argument, runs a single algorithm and draws the ring in the terminal as it goes, e.g. go run main.go animate -alg 0 -bh 12 -ringSize 30")
+		fmt.Println("\tmodelcheck\n\t\tas the first argument, runs a single algorithm under every schedule of its agents that may change the outcome, for every black hole unless -bh is given, e.g. go run main.go modelcheck -alg 0 -ringSize 6")
+		fmt.Println("\t-alg\n\t\t100: run all" + algorithmList("\n\t\t"))
 		fmt.Println("\t-bh\n\t\twill set the node ID of the black hole (please don't set it to 0, as that's where agents start the search)")
+		fmt.Println("\t-k\n\t\twill set the number of black holes, the ones other than -bh are placed from the seed and searched for with ShadowPairs")
+		fmt.Println("\t-blackLink\n\t\twill turn the link between node bh and the next one into a black link, and search for it with BlackLinkPairs instead")
+		fmt.Println("\t-grayHole\n\t\twill turn the black hole into a gray hole destroying arriving agents with the given probability (drawn from the seed)")
+		fmt.Println("\t-grayEvery\n\t\twill turn the black hole into a gray hole destroying every k-th arriving agent")
+		fmt.Println("\t-homebases\n\t\twill start one agent from each of the given nodes (e.g. 0,7,13), and search with Scattered instead")
+		fmt.Println("\t-delays\n\t\tunit: every link takes a time unit to cross (default)\n\t\tconstant: every link takes maxDelay\n\t\trandom: each link takes from 1 to maxDelay in each direction, picked from the seed\n\t\tadversarial: the first crossing of each link takes maxDelay, the following ones 1")
+		fmt.Println("\t-maxDelay\n\t\twill set the time units it takes to cross a link, at most, with -delays")
 		fmt.Println("\t-ringSize\n\t\twill set the number of nodes in the ring")
+		fmt.Println("\t-policy\n\t\tsync: agents move in lockstep rounds (default)\n\t\tsequential: agents run one after the other on a single goroutine, only for algorithms where they never wait for one another (OptAvgTime and OptTime), and take the same time as in lockstep rounds\n\t\trandom, roundrobin, starve or nearbh: one agent acts at a time, picked by an adversary")
+		fmt.Println("\t-engine\n\t\tgoroutines: each agent runs on a goroutine of its own, contending for whiteboards (default)\n\t\tevents: agents are state machines an event loop steps on a single goroutine, earliest clock first, so the same inputs always give the same run, only with the sync policy and for algorithms written that way (Divide, OptAvgTime, OptTeamSize, OptTime and TokenCount)")
+		fmt.Println("\t-seed\n\t\twill set the seed of the adversary, the same seed replays the same run")
+		fmt.Println("\t-unoriented\n\t\twill randomly swap the port labels of each node (from the seed), so agents share no sense of direction")
+		fmt.Println("\t-anonymous\n\t\twill hide node IDs from agents, which count their location from the homebase instead")
+		fmt.Println("\t-compact\n\t\twill only allocate the nodes, whiteboards and tokens of the ring once agents need them, e.g. go run main.go -alg 4 -bh 999999 -ringSize 1000000 -compact -policy sequential")
+		fmt.Println("\t-out\n\t\twill set the file the trace is written to, stdout by default")
+		fmt.Println("\t-format\n\t\tjsonl: the trace has a JSON object per line (default)\n\t\tchrome: the trace opens in Perfetto or chrome://tracing, with a track per agent and a span per walk\n\t\tsvg: the trace is a space-time diagram, with a polyline per agent going through node IDs as time goes down")
+		fmt.Println("\t-check\n\t\twill check the invariants of cautious walk as agents go, print each violation, and exit with status 1 if any")
+		fmt.Println("\t-dot\n\t\twill write the state of the ring and its whiteboards as a Graphviz DOT graph to the given file, once a single algorithm ran")
+		fmt.Println("\t-frame\n\t\twill set how long the animation shows each time unit, e.g. 50ms")
+		fmt.Println("\t-runs\n\t\twill set the most runs the modelcheck mode tries for each black hole, it then reports whether it tried every schedule")
+		fmt.Println("\t-timeout\n\t\twill set how long a single search may take (1m by default, 0 for ever), a search past it is given up on, with where each agent was blocked, and the exit status is 1")
 		fmt.Println("\t-help\n\t\twill display help information")
 		return
 	}
 
-	algorithms := []*blackHoleSearchAlgorithm{
-		&blackHoleSearchAlgorithm{"Divide", algorithms.Divide, true},
-		&blackHoleSearchAlgorithm{"Group", algorithms.Group, false},
-		&blackHoleSearchAlgorithm{"OptAvgTime", algorithms.OptAvgTime, false},
-		&blackHoleSearchAlgorithm{"OptTeamSize", algorithms.OptTeamSize, true},
-		&blackHoleSearchAlgorithm{"OptTime", algorithms.OptTime, false},
+	if mode == "modelcheck" {
+		blackHole := bhs.NodeID(0) // every one
+		flag.Visit(func(given *flag.Flag) {
+			if given.Name == "bh" {
+				blackHole = bhs.NodeID(blackHoleNodeID)
+			}
+		})
+		if !modelCheck(runAlgorithm, ringSize, blackHole, runs) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if _, ok := policies[policy]; !ok && policy != "sync" && policy != "sequential" {
+		fmt.Printf("Unknown scheduling policy %s", policy)
+		return
+	}
+	if engine != "goroutines" && engine != "events" {
+		fmt.Printf("Unknown engine %s", engine)
+		return
+	}
+	if engine == "events" && policy != "sync" {
+		fmt.Printf("The events engine steps agents in lockstep rounds, which only goes with the sync policy")
+		return
+	}
+	newScheduler := func() bhs.Scheduler {
+		if engine == "events" {
+			return bhs.NewEngine()
+		}
+		switch policy {
+		case "sync":
+			return bhs.NewSynchronousScheduler()
+		case "sequential":
+			return bhs.NewSequentialScheduler()
+		}
+		return bhs.NewAdversarialScheduler(policies[policy], seed)
 	}
 
-	if runAlgorithm == 100 {
-		allAlgorithms(ringSize, algorithms)
+	var ringOptions []bhs.RingOption
+	if compact {
+		ringOptions = append(ringOptions, bhs.Compact())
+	}
+	if unoriented {
+		ringOptions = append(ringOptions, bhs.Unoriented(seed))
+	}
+	if anonymous {
+		ringOptions = append(ringOptions, bhs.Anonymous())
+	}
+	switch delays {
+	case "unit":
+	case "constant":
+		ringOptions = append(ringOptions, bhs.ConstantDelays(maxDelay))
+	case "random":
+		ringOptions = append(ringOptions, bhs.RandomDelays(maxDelay, seed))
+	case "adversarial":
+		ringOptions = append(ringOptions, bhs.AdversarialDelays(maxDelay))
+	default:
+		fmt.Printf("Unknown link delays %s", delays)
+		return
+	}
+	if grayHole > 0 {
+		ringOptions = append(ringOptions, bhs.GrayHole(grayHole, seed))
+	} else if grayEvery > 0 {
+		ringOptions = append(ringOptions, bhs.GrayHoleEvery(grayEvery))
+	}
+
+	// other searches only run on the ring given by the bh flag
+	otherSearch := blackHoles > 1 || blackLink || homebases != ""
+	defer func() { // after the trace is written
+		if hung {
+			os.Exit(1)
+		}
+	}()
+	if check { // before the trace mode, so the trace is written out before exiting
+		checker := bhs.NewChecker(func(violation bhs.Violation) { fmt.Fprintln(os.Stderr, violation) })
+		ringOptions = append(ringOptions, bhs.WithTracer(checker))
+		defer func() {
+			if violations := checker.Violations(); len(violations) > 0 {
+				fmt.Fprintf(os.Stderr, "\n%d invariant violations\n", len(violations))
+				os.Exit(1)
+			}
+		}()
+	}
+	var animation *bhs.Animation
+	var spaceTime *bhs.SpaceTime // shades the black hole found, with -format svg
+	if mode == "trace" {
+		if runAlgorithm == 100 && !otherSearch {
+			fmt.Printf("The trace mode runs a single search, please pick an algorithm with -alg")
+			return
+		}
+		tracer, finish, err := traceTo(out, format, ringSize)
+		if err != nil {
+			fmt.Printf("Can't write the trace: %v", err)
+			return
+		}
+		defer finish()
+		ringOptions = append(ringOptions, bhs.WithTracer(tracer))
+		spaceTime, _ = tracer.(*bhs.SpaceTime)
+	}
+	if mode == "animate" {
+		if runAlgorithm == 100 || otherSearch {
+			fmt.Printf("The animate mode runs a single algorithm, please pick one with -alg")
+			return
+		}
+		animation = bhs.NewAnimation(os.Stdout, ringSize, frame)
+		ringOptions = append(ringOptions, bhs.WithTracer(animation))
+	}
+
+	if policy == "sequential" && otherSearch {
+		fmt.Printf("The sequential policy runs algorithms where agents never wait for one another, which other searches aren't")
+		return
+	}
+	if policy == "sequential" && (delays != "unit" || grayHole > 0 || grayEvery > 0) {
+		fmt.Printf("Gray holes and link delays go by the order agents get somewhere, which the sequential policy changes")
+		return
+	}
+
+	if engine == "events" && otherSearch {
+		fmt.Printf("The events engine steps the agents of registered algorithms, which other searches aren't")
+		return
+	}
+
+	if dot != "" && (runAlgorithm == 100 || otherSearch) {
+		fmt.Printf("The state of the ring is written once a single algorithm ran, please pick one with -alg")
+		return
+	}
+
+	if runAlgorithm == 100 && !otherSearch {
+		allAlgorithms(ringSize, newScheduler, ringOptions, anonymous)
 		return
 	}
 
@@ -65,46 +285,337 @@ func main() {
 		return
 	}
 
-	if ringSize < 10 {
+	if otherSearch && ringSize < 10 {
 		fmt.Printf("We have decided that the ring size must at least be 10, but you gave %d", ringSize)
 		return
 	}
 
-	ring := bhs.BuildRing(bhs.NodeID(blackHoleNodeID), ringSize, algorithms[runAlgorithm].hasWhiteBoard)
-	returnedID, _, _ := algorithms[runAlgorithm].algorithm(ring)
-	fmt.Printf("(%s)\t Expected %d\tgot %d\t ring size %d", algorithms[runAlgorithm].algorithmName, blackHoleNodeID, returnedID, ringSize)
+	if homebases != "" {
+		scattered(bhs.NodeID(blackHoleNodeID), ringSize, homebases, newScheduler(), ringOptions, anonymous)
+		return
+	}
+
+	if blackLink {
+		searchBlackLink(bhs.NodeID(blackHoleNodeID), ringSize, newScheduler(), ringOptions, anonymous)
+		return
+	}
+
+	if blackHoles > 1 {
+		multipleBlackHoles(bhs.NodeID(blackHoleNodeID), ringSize, blackHoles, seed, newScheduler(), ringOptions, anonymous)
+		return
+	}
+
+	registered := algorithms.All()
+	if runAlgorithm < 0 || runAlgorithm >= len(registered) {
+		fmt.Printf("Algorithms go from 0-%d, or 100 to run them all, but you gave %d", len(registered)-1, runAlgorithm)
+		return
+	}
+	algorithm := registered[runAlgorithm]
+	if ringSize < algorithm.MinRingSize() {
+		fmt.Printf("%s needs a ring of at least %d nodes, but you gave %d", algorithm.Name(), algorithm.MinRingSize(), ringSize)
+		return
+	}
+	if policy == "sequential" && !algorithm.Model().Independent {
+		fmt.Printf("%s has agents wait for one another, so they can't run one after the other with the sequential policy", algorithm.Name())
+		return
+	}
+	if engine == "events" && !algorithm.Machines() {
+		fmt.Printf("%s has no agents written as state machines, so it only runs with the goroutines engine", algorithm.Name())
+		return
+	}
+
+	var ring bhs.Ring
+	var result bhs.Result
+	var err error
+	memory := bhs.MeasureMemory(func() {
+		ring = algorithm.Model().BuildRing(bhs.NodeID(blackHoleNodeID), ringSize, ringOptions...)
+		result, err = runWithin(ring, newScheduler(), algorithm.Run)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "(%s)\t %v\n", algorithm.Name(), err)
+		return
+	}
+	returnedID := result.BlackHole
+	if anonymous {
+		returnedID = ring.NodeAt(result.Homebase, returnedID) // agents only know where the black hole is from their homebase
+	}
+	if animation != nil {
+		animation.Found(returnedID)
+		animation.Draw()
+	}
+	if spaceTime != nil {
+		spaceTime.Found(returnedID)
+	}
+	if dot != "" {
+		if err := writeDOT(ring, dot); err != nil {
+			fmt.Fprintf(os.Stderr, "Can't write the state of the ring: %v\n", err)
+		}
+	}
+	fmt.Fprintf(report, "(%s)\t Expected %d\tgot %d\t ring size %d\t policy %s\t seed %d\n", algorithm.Name(), blackHoleNodeID, returnedID, ringSize, policy, seed)
+	fmt.Fprintf(report, "moves %d\t time %d\t team %d\t destroyed %d\t all survivors home %t\n", result.Moves, result.Time, result.TeamSize, result.Destroyed, result.AllHome)
+	fmt.Fprintf(report, "memory %s allocated\t allocations %d\t live %s", byteSize(memory.Allocated), memory.Allocations, byteSize(memory.Live))
+}
+
+// modelCheck runs an algorithm under every schedule that may change its outcome, on a ring with the given black hole or every one
+// Returns whether every schedule was run and none went wrong, after printing how each black hole went along with any counterexample schedule
+func modelCheck(runAlgorithm int, ringSize uint64, blackHole bhs.NodeID, runs int) bool {
+	registered := algorithms.All()
+	if runAlgorithm < 0 || runAlgorithm >= len(registered) {
+		fmt.Printf("The modelcheck mode runs a single algorithm, from 0-%d, but you gave %d", len(registered)-1, runAlgorithm)
+		return false
+	}
+	algorithm := registered[runAlgorithm]
+
+	blackHoles := []bhs.NodeID{blackHole}
+	if blackHole == 0 {
+		blackHoles = nil
+		for id := bhs.NodeID(1); id < bhs.NodeID(ringSize); id++ {
+			blackHoles = append(blackHoles, id)
+		}
+	}
+	for _, blackHole := range blackHoles {
+		report, err := algorithms.ModelCheck(algorithm, blackHole, ringSize, runs)
+		switch {
+		case err != nil:
+			fmt.Printf("Can't model check: %v", err)
+			return false
+		case report.Err != nil:
+			fmt.Printf("(%s)\t black hole %d\t run %d went wrong: %v\nSchedule, between moves:\n%s", algorithm.Name(), blackHole, report.Runs, report.Err, report.Schedule())
+			return false
+		case report.Complete:
+			fmt.Printf("(%s)\t black hole %d\t every schedule is right, in %d runs\n", algorithm.Name(), blackHole, report.Runs)
+		default:
+			fmt.Printf("(%s)\t black hole %d\t the first %d runs are right, but some schedules are left past -runs, so the check is incomplete\n", algorithm.Name(), blackHole, report.Runs)
+			return false
+		}
+	}
+	return true
+}
+
+// runWithin runs a search on the ring, giving up on it past the timeout
+// A search given up on sets hung, and its error tells where each agent was blocked
+func runWithin(ring bhs.Ring, scheduler bhs.Scheduler, search func(bhs.Ring, bhs.Scheduler) bhs.Result) (bhs.Result, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+	result, err := bhs.RunContext(ctx, ring, scheduler, search)
+	if err != nil {
+		hung = true
+	}
+	return result, err
+}
+
+// traceTo opens what the trace mode writes to in the given format, stdout if no file is given
+// Returns the tracer, along with a function to call once the search is over, which reports write errors
+func traceTo(out string, format string, ringSize uint64) (bhs.Tracer, func(), error) {
+	if format != "jsonl" && format != "chrome" && format != "svg" {
+		return nil, nil, fmt.Errorf("unknown format %s", format)
+	}
+
+	writer := io.WriteCloser(os.Stdout)
+	if out == "" {
+		report = os.Stderr // keeps the trace alone on stdout
+	} else {
+		file, err := os.Create(out)
+		if err != nil {
+			return nil, nil, err
+		}
+		writer = file
+	}
+
+	buffered := bufio.NewWriter(writer)
+	jsonTracer := bhs.NewJSONTracer(buffered)
+	tracer, collected := bhs.Tracer(jsonTracer), io.WriterTo(nil) // Chrome traces and SVGs are written once the search is over
+	switch format {
+	case "chrome":
+		chromeTracer := bhs.NewChromeTracer()
+		tracer, collected = chromeTracer, chromeTracer
+	case "svg":
+		spaceTime := bhs.NewSpaceTime(ringSize)
+		tracer, collected = spaceTime, spaceTime
+	}
+	finish := func() {
+		err := jsonTracer.Err()
+		if collected != nil {
+			_, err = collected.WriteTo(buffered)
+		}
+		if err == nil {
+			err = buffered.Flush()
+		}
+		if out != "" {
+			if closeErr := writer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nCan't write the trace: %v", err)
+		}
+	}
+	return tracer, finish, nil
+}
+
+// writeDOT writes the state of the ring to a file as a DOT graph
+func writeDOT(ring bhs.Ring, name string) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err = ring.WriteDOT(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// algorithmList lists the registered algorithms with the number that runs them, each after the separator
+func algorithmList(separator string) string {
+	var list string
+	for i, algorithm := range algorithms.All() {
+		list += fmt.Sprintf("%s%d: %s", separator, i, algorithm.Name())
+	}
+	return list
 }
 
-func allAlgorithms(ringSize uint64, algorithms []*blackHoleSearchAlgorithm) {
+func allAlgorithms(ringSize uint64, newScheduler func() bhs.Scheduler, ringOptions []bhs.RingOption, anonymous bool) {
 	yellow := color.New(color.FgYellow).SprintFunc()
 	red := color.New(color.FgRed).SprintFunc()
 	green := color.New(color.FgGreen).SprintFunc()
 
+	scheduler := newScheduler()
+	_, sequential := scheduler.(*bhs.SequentialScheduler)
+	_, events := scheduler.(*bhs.Engine)
 	fmt.Printf("Analysis for algorithms in a ring of size %d\n", ringSize)
-	for _, blackHoleSearchAlgorithm := range algorithms {
+	for _, algorithm := range algorithms.All() {
+		if ringSize < algorithm.MinRingSize() {
+			fmt.Printf("(%s)\t needs a ring of at least %d nodes\n\n", algorithm.Name(), algorithm.MinRingSize())
+			continue
+		}
+		if sequential && !algorithm.Model().Independent {
+			fmt.Printf("(%s)\t has agents wait for one another, so they can't run one after the other\n\n", algorithm.Name())
+			continue
+		}
+		if events && !algorithm.Machines() {
+			fmt.Printf("(%s)\t has no agents written as state machines for the events engine\n\n", algorithm.Name())
+			continue
+		}
+
 		var stats statistics
+		var completed uint64 // runs that weren't given up on
 		for blackHoleNodeID := bhs.NodeID(1); blackHoleNodeID < bhs.NodeID(ringSize); blackHoleNodeID++ {
-			ring := bhs.BuildRing(blackHoleNodeID, ringSize, blackHoleSearchAlgorithm.hasWhiteBoard)
-			returnedID, moveC, timeC := blackHoleSearchAlgorithm.algorithm(ring)
+			var ring bhs.Ring
+			var result bhs.Result
+			var err error
+			memory := bhs.MeasureMemory(func() {
+				ring = algorithm.Model().BuildRing(blackHoleNodeID, ringSize, ringOptions...)
+				result, err = runWithin(ring, newScheduler(), algorithm.Run)
+			})
+			if err != nil {
+				fmt.Printf("(%s)\t black hole %d\t %v\n", algorithm.Name(), blackHoleNodeID, err)
+				continue
+			}
+			returnedID := result.BlackHole
+			if anonymous {
+				returnedID = ring.NodeAt(result.Homebase, returnedID)
+			}
 
 			// compute stats
-			if blackHoleNodeID == 1 {
-				stats.move.min, stats.time.min = moveC, timeC // default min value
+			first := completed == 0
+			completed++
+			stats.move.add(result.Moves, first)
+			stats.time.add(result.Time, first)
+			stats.team.add(result.TeamSize, first)
+			stats.destroyed.add(result.Destroyed, first)
+			stats.memory.add(memory.Allocated, first)
+			if result.AllHome {
+				stats.home++
 			}
-			minMove, minTime := helpers.MinUint64(stats.move.min, moveC), helpers.MinUint64(stats.time.min, timeC)
-			maxMove, maxTime := helpers.MaxUint64(stats.move.max, moveC), helpers.MaxUint64(stats.time.max, timeC)
-			avgMove, avgTime := stats.move.average+moveC, stats.time.average+timeC
-			stats = statistics{move: measures{minMove, maxMove, avgMove}, time: measures{minTime, maxTime, avgTime}}
 
 			if returnedID != blackHoleNodeID {
-				fmt.Printf("(%s)\t Expected %d\tgot %d", blackHoleSearchAlgorithm.algorithmName, blackHoleNodeID, returnedID)
+				fmt.Printf("(%s)\t Expected %d\tgot %d", algorithm.Name(), blackHoleNodeID, returnedID)
 			}
 		}
 
 		color.Set(color.FgBlue, color.Bold, color.Underline)
-		fmt.Printf("%s\n", blackHoleSearchAlgorithm.algorithmName)
+		fmt.Printf("%s\n", algorithm.Name())
 		color.Unset()
-		fmt.Printf("Time\t min: %s | avg: %s | max: %s]\n", green(stats.time.min), yellow(stats.time.average/(ringSize-1)), red(stats.time.max))
-		fmt.Printf("Move\t min: %s | avg: %s | max: %s]\n\n", green(stats.move.min), yellow(stats.move.average/(ringSize-1)), red(stats.move.max))
+		if completed == 0 {
+			fmt.Printf("Every run was given up on\n\n")
+			continue
+		}
+		fmt.Printf("Time\t min: %s | avg: %s | max: %s]\n", green(stats.time.min), yellow(stats.time.average/completed), red(stats.time.max))
+		fmt.Printf("Move\t min: %s | avg: %s | max: %s]\n", green(stats.move.min), yellow(stats.move.average/completed), red(stats.move.max))
+		fmt.Printf("Team\t min: %s | avg: %s | max: %s]\n", green(stats.team.min), yellow(stats.team.average/completed), red(stats.team.max))
+		fmt.Printf("Lost\t min: %s | avg: %s | max: %s]\n", green(stats.destroyed.min), yellow(stats.destroyed.average/completed), red(stats.destroyed.max))
+		fmt.Printf("Memory\t min: %s | avg: %s | max: %s]\n", green(byteSize(stats.memory.min)), yellow(byteSize(stats.memory.average/completed)), red(byteSize(stats.memory.max)))
+		fmt.Printf("Home\t every survivor in %d of %d runs\n\n", stats.home, completed)
+	}
+}
+
+// multipleBlackHoles searches a ring with k black holes, only the ones closest to the homebase on each side can be found
+func multipleBlackHoles(blackHoleNodeID bhs.NodeID, ringSize uint64, k int, seed int64, scheduler bhs.Scheduler, ringOptions []bhs.RingOption, anonymous bool) {
+	ring := bhs.BuildRing(blackHoleNodeID, ringSize, true, append(ringOptions, bhs.RandomBlackHoles(k-1, seed))...)
+	var returnedIDs []bhs.NodeID
+	result, err := runWithin(ring, scheduler, func(ring bhs.Ring, scheduler bhs.Scheduler) (result bhs.Result) {
+		returnedIDs, result = algorithms.ShadowPairs(ring, scheduler)
+		return
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "(ShadowPairs)\t %v\n", err)
+		return
+	}
+	if anonymous {
+		for i, location := range returnedIDs {
+			returnedIDs[i] = ring.NodeAt(0, location)
+		}
+	}
+	fmt.Fprintf(report, "(ShadowPairs)\t Black holes %v\treachable %v\tgot %v\t moves %d\t time %d", ring.BlackHoles(), ring.ReachableBlackHoles(), returnedIDs, result.Moves, result.Time)
+}
+
+// searchBlackLink searches a ring where the link between node id and the next one is black
+func searchBlackLink(id bhs.NodeID, ringSize uint64, scheduler bhs.Scheduler, ringOptions []bhs.RingOption, anonymous bool) {
+	ring := bhs.BuildRing(id, ringSize, true, append(ringOptions, bhs.BlackLink(id))...)
+	var ends [2]bhs.NodeID
+	result, err := runWithin(ring, scheduler, func(ring bhs.Ring, scheduler bhs.Scheduler) (result bhs.Result) {
+		ends, result = algorithms.BlackLinkPairs(ring, scheduler)
+		return
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "(BlackLinkPairs)\t %v\n", err)
+		return
+	}
+	if anonymous {
+		ends = [2]bhs.NodeID{ring.NodeAt(0, ends[0]), ring.NodeAt(0, ends[1])}
+	}
+	fmt.Fprintf(report, "(BlackLinkPairs)\t Expected %d-%d\tgot %d-%d\t moves %d\t time %d", id, (id+1)%bhs.NodeID(ringSize), ends[0], ends[1], result.Moves, result.Time)
+}
+
+// scattered searches a ring with one agent starting from each of the comma-separated homebases
+func scattered(blackHoleNodeID bhs.NodeID, ringSize uint64, homebases string, scheduler bhs.Scheduler, ringOptions []bhs.RingOption, anonymous bool) {
+	var ids []bhs.NodeID
+	for _, homebase := range strings.Split(homebases, ",") {
+		id, err := strconv.ParseUint(homebase, 10, 64)
+		if err != nil || id >= ringSize || bhs.NodeID(id) == blackHoleNodeID {
+			fmt.Printf("Homebases must be nodes from 0-%d other than the black hole, but you gave %s", ringSize-1, homebase)
+			return
+		}
+		ids = append(ids, bhs.NodeID(id))
+	}
+	if len(ids) < 2 {
+		fmt.Printf("Scattered needs at least 2 homebases, as an agent falls in the black hole, but you gave %d", len(ids))
+		return
+	}
+
+	ring := bhs.BuildRing(blackHoleNodeID, ringSize, true, append(ringOptions, bhs.Homebases(ids...))...)
+	result, err := runWithin(ring, scheduler, algorithms.Scattered)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "(Scattered)\t %v\n", err)
+		return
+	}
+	returnedID := result.BlackHole
+	if anonymous {
+		returnedID = ring.NodeAt(result.Homebase, returnedID) // counted from the homebase of the agent that found it
 	}
+	fmt.Fprintf(report, "(Scattered)\t Expected %d\tgot %d\t homebases %v\t moves %d\t time %d\t destroyed %d", blackHoleNodeID, returnedID, ids, result.Moves, result.Time, result.Destroyed)
 }
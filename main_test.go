@@ -1,24 +1,97 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"./bhs"
 	"./bhs/algorithms"
+	"github.com/fatih/color"
 )
 
-func runTest(hasWhiteBoards bool, algo func(r bhs.Ring) (bhs.NodeID, uint64, uint64), t *testing.T) {
+func runTest(hasWhiteBoards bool, algo func(bhs.Ring, bhs.Scheduler) bhs.Result, t *testing.T) {
 	var size uint64 = 100
 
 	for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
 		r := bhs.BuildRing(i, size, hasWhiteBoards)
 
-		if result, _, _ := algo(r); result != i {
+		if result := algo(r, bhs.NewSynchronousScheduler()).BlackHole; result != i {
 			t.Errorf("Expected %v, got %d", i, result)
 		}
 	}
 }
 
+func TestRegistry(t *testing.T) {
+	// every registered algorithm finds the black hole from its smallest ring up, with what its model asks for
+	for _, algorithm := range algorithms.All() {
+		for size := algorithm.MinRingSize(); size <= 12; size++ {
+			for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+				r := algorithm.Model().BuildRing(i, size)
+				if result := algorithm.Run(r, bhs.NewSynchronousScheduler()).BlackHole; result != i {
+					t.Errorf("(%s, ring size %d) Expected %v, got %d", algorithm.Name(), size, i, result)
+				}
+			}
+		}
+
+		if found, ok := algorithms.Lookup(algorithm.Name()); !ok || found.Name() != algorithm.Name() {
+			t.Errorf("Expected to look %s up by name", algorithm.Name())
+		}
+	}
+}
+
+func TestResult(t *testing.T) {
+	var size uint64 = 12
+
+	// the result adds up what every agent of the team did
+	for _, algorithm := range algorithms.All() {
+		for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+			result := algorithm.Run(algorithm.Model().BuildRing(i, size), bhs.NewSynchronousScheduler())
+			if result.TeamSize != algorithm.TeamSize(size) || uint64(len(result.Agents)) != result.TeamSize {
+				t.Errorf("(%s) Expected a team of %d agents, got %d reporting on %d", algorithm.Name(), algorithm.TeamSize(size), result.TeamSize, len(result.Agents))
+			}
+
+			var moves, destroyed uint64
+			allHome := true
+			for _, agent := range result.Agents {
+				moves += agent.Moves
+				if agent.Fate == bhs.Destroyed {
+					destroyed++
+				}
+				allHome = allHome && agent.Fate != bhs.Away
+			}
+			if moves != result.Moves || destroyed != result.Destroyed || allHome != result.AllHome {
+				t.Errorf("(%s) Expected %d moves, %d destroyed and all home %t, got %d, %d and %t", algorithm.Name(), moves, destroyed, allHome, result.Moves, result.Destroyed, result.AllHome)
+			}
+			if result.Destroyed == 0 { // someone has to enter the black hole to find it
+				t.Errorf("(%s) Expected at least an agent destroyed", algorithm.Name())
+			}
+		}
+	}
+}
+
+func BenchmarkRegistry(b *testing.B) {
+	for _, algorithm := range algorithms.All() {
+		b.Run(algorithm.Name(), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				algorithm.Run(algorithm.Model().BuildRing(999, 1000), bhs.NewSynchronousScheduler())
+			}
+		})
+	}
+}
+
 func TestOptAvgTime(t *testing.T) {
 	runTest(false, algorithms.OptAvgTime, t)
 }
@@ -27,7 +100,7 @@ func benchmarkOptAvgTime(i uint64, b *testing.B) {
 	r := bhs.BuildRing(bhs.NodeID(i-1), i, false)
 
 	for n := 0; n < b.N; n++ {
-		algorithms.OptAvgTime(r)
+		algorithms.OptAvgTime(r, bhs.NewSynchronousScheduler())
 	}
 }
 func BenchmarkOptAvgTime10000(b *testing.B) { benchmarkOptAvgTime(1000, b) }
@@ -36,11 +109,22 @@ func TestOptTime(t *testing.T) {
 	runTest(false, algorithms.OptTime, t)
 }
 
+func TestOptTimeIdealTime(t *testing.T) {
+	var size uint64 = 100
+
+	// every agent moves in lockstep, so the agent checking the black hole is back after visiting all other nodes
+	for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+		if time := algorithms.OptTime(bhs.BuildRing(i, size, false), bhs.NewSynchronousScheduler()).Time; time != 2*(size-2) {
+			t.Errorf("Expected time %d, got %d", 2*(size-2), time)
+		}
+	}
+}
+
 func benchmarkOptTime(i uint64, b *testing.B) {
 	r := bhs.BuildRing(bhs.NodeID(i-1), i, false)
 
 	for n := 0; n < b.N; n++ {
-		algorithms.OptTime(r)
+		algorithms.OptTime(r, bhs.NewSynchronousScheduler())
 	}
 }
 func BenchmarkOptTime10000(b *testing.B) { benchmarkOptTime(1000, b) }
@@ -53,7 +137,7 @@ func benchmarkOptTeamSize(i uint64, b *testing.B) {
 	r := bhs.BuildRing(bhs.NodeID(i-1), i, true)
 
 	for n := 0; n < b.N; n++ {
-		algorithms.OptTeamSize(r)
+		algorithms.OptTeamSize(r, bhs.NewSynchronousScheduler())
 	}
 }
 func BenchmarkOptTeamSize10000(b *testing.B) { benchmarkOptTeamSize(1000, b) }
@@ -66,7 +150,7 @@ func benchmarkDivide(i uint64, b *testing.B) {
 	r := bhs.BuildRing(bhs.NodeID(i-1), i, true)
 
 	for n := 0; n < b.N; n++ {
-		algorithms.Divide(r)
+		algorithms.Divide(r, bhs.NewSynchronousScheduler())
 	}
 }
 func BenchmarkDivide10000(b *testing.B) { benchmarkDivide(1000, b) }
@@ -79,7 +163,983 @@ func benchmarkGroup(i uint64, b *testing.B) {
 	r := bhs.BuildRing(bhs.NodeID(i-1), i, true)
 
 	for n := 0; n < b.N; n++ {
-		algorithms.Group(r)
+		algorithms.Group(r, bhs.NewSynchronousScheduler())
 	}
 }
 func BenchmarkGroup10000(b *testing.B) { benchmarkGroup(1000, b) }
+
+func TestTokenCount(t *testing.T) {
+	var size uint64 = 100
+
+	for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+		r := bhs.BuildRing(i, size, false, bhs.WithTokens())
+
+		if result := algorithms.TokenCount(r, bhs.NewSynchronousScheduler()).BlackHole; result != i {
+			t.Errorf("Expected %v, got %d", i, result)
+		}
+	}
+
+	// an agent waits in front of a link another one is exploring, rather than failing to cross it
+	r := bhs.BuildRing(10, size, false, bhs.WithTokens())
+	scheduler := bhs.NewSynchronousScheduler()
+	agents := []*bhs.Agent{bhs.NewAgent(bhs.Left, r, true, scheduler), bhs.NewAgent(bhs.Left, r, true, scheduler)}
+	errs := make(chan error, len(agents))
+	for _, agent := range agents {
+		go func(agent *bhs.Agent) {
+			defer agent.Terminate()
+			_, err := agent.Move(bhs.Left)
+			errs <- err
+		}(agent)
+	}
+	scheduler.Start()
+	for range agents {
+		if err := <-errs; err != nil {
+			t.Errorf("Expected both agents across the link, got %v", err)
+		}
+	}
+	if agents[0].Location() != 1 || agents[1].Location() != 1 || scheduler.Time() <= 3 {
+		t.Errorf("Expected both agents on node 1 one after the other, got nodes %d and %d at time %d", agents[0].Location(), agents[1].Location(), scheduler.Time())
+	}
+}
+
+func benchmarkTokenCount(i uint64, b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		algorithms.TokenCount(bhs.BuildRing(bhs.NodeID(i-1), i, false, bhs.WithTokens()), bhs.NewSynchronousScheduler())
+	}
+}
+func BenchmarkTokenCount1000(b *testing.B) { benchmarkTokenCount(1000, b) }
+
+func TestTokenCountAdversarial(t *testing.T) {
+	var size uint64 = 20
+
+	// agents count their location from the homebase, so the count tokens work without IDs nor a common sense of direction
+	for _, policy := range []bhs.Policy{bhs.RandomPolicy, bhs.StarvePolicy, bhs.NearBlackHolePolicy} {
+		for seed := int64(1); seed <= 3; seed++ {
+			for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+				r := bhs.BuildRing(i, size, false, bhs.WithTokens(), bhs.Unoriented(seed), bhs.Anonymous())
+				if result := algorithms.TokenCount(r, bhs.NewAdversarialScheduler(policy, seed)).BlackHole; r.NodeAt(0, result) != i {
+					t.Errorf("(policy %d, seed %d) Expected %v, got %d", policy, seed, i, result)
+				}
+			}
+		}
+	}
+}
+
+func TestShadowPairs(t *testing.T) {
+	var size uint64 = 30
+
+	for seed := int64(1); seed <= 5; seed++ {
+		for k := 0; k < 4; k++ {
+			r := bhs.BuildRing(bhs.NodeID(seed), size, true, bhs.RandomBlackHoles(k, seed))
+			result, _ := algorithms.ShadowPairs(r, bhs.NewSynchronousScheduler())
+			if expected := r.ReachableBlackHoles(); !reflect.DeepEqual(result, expected) {
+				t.Errorf("(seed %d, %d black holes) Expected %v, got %v", seed, k+1, expected, result)
+			}
+		}
+	}
+}
+
+func TestBlackLinkPairs(t *testing.T) {
+	var size uint64 = 30
+
+	for i := bhs.NodeID(0); i < bhs.NodeID(size); i++ {
+		for seed := int64(1); seed <= 2; seed++ { // anonymous and unoriented, so the results are locations
+			r := bhs.BuildRing(1, size, true, bhs.BlackLink(i), bhs.Unoriented(seed), bhs.Anonymous())
+			ends, _ := algorithms.BlackLinkPairs(r, bhs.NewSynchronousScheduler())
+			got := map[bhs.NodeID]bool{r.NodeAt(0, ends[0]): true, r.NodeAt(0, ends[1]): true}
+			if expected := map[bhs.NodeID]bool{i: true, (i + 1) % bhs.NodeID(size): true}; !reflect.DeepEqual(got, expected) {
+				t.Errorf("(seed %d) Expected black link %d-%d, got %d-%d", seed, i, (i+1)%bhs.NodeID(size), r.NodeAt(0, ends[0]), r.NodeAt(0, ends[1]))
+			}
+		}
+	}
+
+	// the black link replaces black holes whichever side of it their options are given
+	r := bhs.BuildRing(1, size, true, bhs.BlackHoles(8), bhs.BlackLink(5), bhs.BlackHoles(12), bhs.GrayHoleEvery(2))
+	if r.Node(1).BlackHole || r.Node(8).BlackHole || r.Node(12).BlackHole || r.Node(1).IsGrayHole() {
+		t.Errorf("Expected no black hole left besides the black link")
+	}
+	if ends, _ := algorithms.BlackLinkPairs(r, bhs.NewSynchronousScheduler()); !reflect.DeepEqual(map[bhs.NodeID]bool{ends[0]: true, ends[1]: true}, map[bhs.NodeID]bool{5: true, 6: true}) {
+		t.Errorf("Expected black link 5-6, got %d-%d", ends[0], ends[1])
+	}
+}
+
+func TestRobustTeamSize(t *testing.T) {
+	var size uint64 = 20
+	holes := map[string]func(seed int64) bhs.RingOption{
+		"black hole":    func(seed int64) bhs.RingOption { return bhs.GrayHoleEvery(1) },
+		"every 2nd":     func(seed int64) bhs.RingOption { return bhs.GrayHoleEvery(2) },
+		"every 5th":     func(seed int64) bhs.RingOption { return bhs.GrayHoleEvery(5) },
+		"probabilistic": func(seed int64) bhs.RingOption { return bhs.GrayHole(0.3, seed) },
+	}
+
+	for name, hole := range holes {
+		for seed := int64(1); seed <= 3; seed++ {
+			for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+				r := bhs.BuildRing(i, size, true, hole(seed))
+				if result := algorithms.RobustTeamSize(r, bhs.NewSynchronousScheduler()).BlackHole; result != i {
+					t.Errorf("(%s, seed %d) Expected %v, got %d", name, seed, i, result)
+				}
+			}
+		}
+	}
+
+	// a gray hole that destroys no one is out of reach, the agents give up once they went around enough times
+	for name, hole := range map[string]bhs.RingOption{"probability 0": bhs.GrayHole(0, 1), "every 1000th": bhs.GrayHoleEvery(1000)} {
+		for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+			result := algorithms.RobustTeamSize(bhs.BuildRing(i, size, true, hole), bhs.NewSynchronousScheduler())
+			if result.BlackHole != 0 || result.Destroyed != 0 || !result.AllHome {
+				t.Errorf("(%s) Expected every agent home reporting node 0, got %d with %d agents lost", name, result.BlackHole, result.Destroyed)
+			}
+		}
+	}
+
+	// without whiteboards, the agents can't write their marks and stop right away
+	if result := algorithms.RobustTeamSize(bhs.BuildRing(5, size, false), bhs.NewSynchronousScheduler()); result.BlackHole != 0 || result.Moves != 0 {
+		t.Errorf("Expected no move and node 0 without whiteboards, got %d after %d moves", result.BlackHole, result.Moves)
+	}
+}
+
+func TestGrayHole(t *testing.T) {
+	// each agent draws its own fate on each visit, so a seed destroys the same agents whichever arrives first within a round
+	fates := func(seed int64) []bool {
+		ring, scheduler := bhs.BuildRing(7, 20, false, bhs.GrayHole(0.5, seed)), bhs.NewSynchronousScheduler()
+		agents := make([]*bhs.Agent, 8)
+		for i := range agents {
+			agents[i] = bhs.NewAgent(bhs.Left, ring, false, scheduler)
+		}
+		var wait sync.WaitGroup
+		for _, agent := range agents {
+			wait.Add(1)
+			go func(agent *bhs.Agent) {
+				defer wait.Done()
+				defer agent.Terminate()
+				agent.MoveUntil(bhs.Left, 7)
+			}(agent)
+		}
+		scheduler.Start()
+		wait.Wait()
+
+		active := make([]bool, len(agents))
+		for i, agent := range agents {
+			active[i] = agent.Active
+		}
+		return active
+	}
+	for seed := int64(1); seed <= 5; seed++ {
+		expected := fates(seed)
+		for run := 0; run < 10; run++ {
+			if active := fates(seed); !reflect.DeepEqual(active, expected) {
+				t.Errorf("(seed %d, run %d) Expected agents %v to survive, got %v", seed, run, expected, active)
+			}
+		}
+	}
+}
+
+func TestScattered(t *testing.T) {
+	var size uint64 = 20
+
+	for seed := int64(1); seed <= 5; seed++ {
+		random := rand.New(rand.NewSource(seed))
+		for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+			var homebases []bhs.NodeID // 2 to 5 of the nodes other than the black hole
+			for _, id := range random.Perm(int(size))[:2+random.Intn(4)] {
+				if bhs.NodeID(id) != i {
+					homebases = append(homebases, bhs.NodeID(id))
+				}
+			}
+			if len(homebases) < 2 {
+				continue
+			}
+
+			r := bhs.BuildRing(i, size, true, bhs.Homebases(homebases...))
+			if result := algorithms.Scattered(r, bhs.NewSynchronousScheduler()).BlackHole; result != i {
+				t.Errorf("(homebases %v) Expected %v, got %d", homebases, i, result)
+			}
+
+			// agents of an anonymous ring count from their own homebase, which the result tells
+			r = bhs.BuildRing(i, size, true, bhs.Homebases(homebases...), bhs.Anonymous())
+			if result := algorithms.Scattered(r, bhs.NewSynchronousScheduler()); r.NodeAt(result.Homebase, result.BlackHole) != i {
+				t.Errorf("(homebases %v, anonymous) Expected %v, got %d from homebase %d", homebases, i, result.BlackHole, result.Homebase)
+			}
+		}
+	}
+
+	// the homebase and the unexplored set are where the agent sees them
+	for _, anonymous := range []bool{false, true} {
+		options, homebase, unexploredSet := []bhs.RingOption{bhs.Homebases(8)}, bhs.NodeID(8), [2]bhs.NodeID{9, 7}
+		if anonymous {
+			options, homebase, unexploredSet = append(options, bhs.Anonymous()), 0, [2]bhs.NodeID{1, 19}
+		}
+		team := bhs.NewTeam()
+		agent := team.NewAgentAt(bhs.Left, bhs.BuildRing(5, size, true, options...), true, nil, 8)
+		if agent.HomebaseNodeID != homebase || agent.UnexploredSet != unexploredSet {
+			t.Errorf("(anonymous %t) Expected homebase %d and unexplored set %v, got %d and %v", anonymous, homebase, unexploredSet, agent.HomebaseNodeID, agent.UnexploredSet)
+		}
+		agent.Terminate()
+		if result := team.ResultFrom(agent, 0, 0, 0); result.Homebase != 8 || result.Agents[0].Fate != bhs.Home {
+			t.Errorf("(anonymous %t) Expected the agent home on homebase 8, got %v on homebase %d", anonymous, result.Agents[0].Fate, result.Homebase)
+		}
+	}
+}
+
+func TestLinkDelays(t *testing.T) {
+	var size uint64 = 20
+	algos := map[string]func(bhs.Ring, bhs.Scheduler) bhs.Result{"Group": algorithms.Group, "OptAvgTime": algorithms.OptAvgTime, "OptTime": algorithms.OptTime}
+	delays := map[string]bhs.RingOption{"constant": bhs.ConstantDelays(3), "random": bhs.RandomDelays(5, 1), "adversarial": bhs.AdversarialDelays(5)}
+
+	for name, algo := range algos {
+		for delayName, delay := range delays {
+			for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+				if result := algo(bhs.BuildRing(i, size, false, delay), bhs.NewSynchronousScheduler()).BlackHole; result != i {
+					t.Errorf("(%s, %s delays) Expected %v, got %d", name, delayName, i, result)
+				}
+			}
+		}
+	}
+
+	// links 3 times slower make OptTime 3 times slower
+	if time := algorithms.OptTime(bhs.BuildRing(5, size, false, bhs.ConstantDelays(3)), bhs.NewSynchronousScheduler()).Time; time != 3*2*(size-2) {
+		t.Errorf("Expected OptTime to take %d, got %d", 3*2*(size-2), time)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	var size uint64 = 12
+
+	for _, algorithm := range algorithms.All() {
+		for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+			var traced []bhs.Event
+			var lock sync.Mutex
+			tracer := bhs.TracerFunc(func(event bhs.Event) {
+				lock.Lock()
+				traced = append(traced, event)
+				lock.Unlock()
+			})
+			result := algorithm.Run(algorithm.Model().BuildRing(i, size, bhs.WithTracer(tracer)), bhs.NewSynchronousScheduler())
+			lock.Lock() // agents may still be terminating
+			events := append([]bhs.Event{}, traced...)
+			lock.Unlock()
+
+			// every agent spawns, then ends up destroyed or terminated once, and every move it survived is counted
+			counts := make(map[bhs.EventKind]uint64)
+			ends := make(map[uint64]int)
+			for sequence, event := range events {
+				if event.Sequence != uint64(sequence) || (sequence > 0 && event.Time < events[sequence-1].Time) {
+					t.Errorf("(%s) Expected events in order, got event %d at time %d as event %d", algorithm.Name(), event.Sequence, event.Time, sequence)
+				}
+				counts[event.Kind]++
+				if event.Kind == bhs.AgentDestroyed || event.Kind == bhs.AgentTerminated {
+					ends[event.Agent]++
+				}
+			}
+			if counts[bhs.AgentSpawned] != result.TeamSize || counts[bhs.AgentDestroyed] != result.Destroyed || counts[bhs.AgentMoved] != result.Moves+result.Destroyed {
+				t.Errorf("(%s) Expected %d spawned, %d destroyed and %d moved, got %v", algorithm.Name(), result.TeamSize, result.Destroyed, result.Moves+result.Destroyed, counts)
+			}
+			for agent, count := range ends {
+				if count > 1 {
+					t.Errorf("(%s) Expected agent %d to be destroyed or terminated once, got %d times", algorithm.Name(), agent, count)
+				}
+			}
+		}
+	}
+}
+
+func TestJSONTracer(t *testing.T) {
+	var trace bytes.Buffer
+	tracer := bhs.NewJSONTracer(&trace)
+	tracer.Trace(bhs.Event{Kind: bhs.AgentSpawned, Port: bhs.None, Direction: bhs.None})
+	tracer.Trace(bhs.Event{Kind: bhs.AgentMoved, Sequence: 1, Time: 1, To: 19, Port: 1, Direction: bhs.Right})
+	tracer.Trace(bhs.Event{Kind: bhs.LabelChanged, Sequence: 2, Time: 1, Node: 19, To: 19, Port: 0, Direction: bhs.Left, Label: 2}) // explored
+	tracer.Trace(bhs.Event{Kind: bhs.AgentDestroyed, Sequence: 3, Time: 2, Node: 19, To: 19, Port: bhs.None, Direction: bhs.None})
+	tracer.Trace(bhs.Event{Kind: bhs.UpdateRead, Sequence: 4, Time: 5, Agent: 1, Node: 18, To: 18, Port: bhs.None, Direction: bhs.None, Unexplored: [2]bhs.NodeID{19, 19}})
+
+	// the schema is documented in the README, and must not change
+	expected := `{"seq":0,"time":0,"kind":"spawned","agent":0,"node":0}
+{"seq":1,"time":1,"kind":"moved","agent":0,"node":0,"to":19,"port":1,"direction":"right"}
+{"seq":2,"time":1,"kind":"label_changed","agent":0,"node":19,"port":0,"direction":"left","label":"explored"}
+{"seq":3,"time":2,"kind":"destroyed","agent":0,"node":19}
+{"seq":4,"time":5,"kind":"update_read","agent":1,"node":18,"unexplored":[19,19]}
+`
+	if trace.String() != expected || tracer.Err() != nil {
+		t.Errorf("Expected trace\n%s\ngot\n%s (error %v)", expected, trace.String(), tracer.Err())
+	}
+}
+
+func TestChromeTracer(t *testing.T) {
+	var size uint64 = 20
+
+	for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+		tracer := bhs.NewChromeTracer()
+		result := algorithms.OptTeamSize(bhs.BuildRing(i, size, true, bhs.WithTracer(tracer)), bhs.NewSynchronousScheduler())
+		var trace bytes.Buffer
+		if _, err := tracer.WriteTo(&trace); err != nil {
+			t.Fatalf("Expected to write the trace, got %v", err)
+		}
+
+		var chrome struct {
+			TraceEvents []struct {
+				Name  string `json:"name"`
+				Phase string `json:"ph"`
+				Tid   uint64 `json:"tid"`
+			} `json:"traceEvents"`
+		}
+		if err := json.Unmarshal(trace.Bytes(), &chrome); err != nil {
+			t.Fatalf("Expected a JSON trace, got %v", err)
+		}
+
+		// walks are spans that end on the track they began, and every destroyed agent shows
+		open := make(map[uint64]int)
+		var destroyed uint64
+		for _, event := range chrome.TraceEvents {
+			switch {
+			case event.Phase == "B":
+				open[event.Tid]++
+			case event.Phase == "E":
+				if open[event.Tid]--; open[event.Tid] < 0 {
+					t.Errorf("(black hole %d) Expected agent %d to end a walk it began", i, event.Tid)
+				}
+			case event.Name == "destroyed":
+				destroyed++
+			}
+		}
+		for agent, walks := range open {
+			if walks != 0 {
+				t.Errorf("(black hole %d) Expected agent %d to end its walks, %d left", i, agent, walks)
+			}
+		}
+		if destroyed != result.Destroyed {
+			t.Errorf("(black hole %d) Expected %d agents destroyed, got %d", i, result.Destroyed, destroyed)
+		}
+	}
+}
+
+func TestSpaceTime(t *testing.T) {
+	var size uint64 = 12
+
+	for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+		spaceTime := bhs.NewSpaceTime(size)
+		result := algorithms.OptTime(bhs.BuildRing(i, size, true, bhs.WithTracer(spaceTime)), bhs.NewSynchronousScheduler())
+		spaceTime.Found(result.BlackHole)
+		var diagram bytes.Buffer
+		if _, err := spaceTime.WriteTo(&diagram); err != nil {
+			t.Fatalf("Expected to write the diagram, got %v", err)
+		}
+
+		var svg struct {
+			Polylines []struct {
+				Title string `xml:"title"`
+			} `xml:"polyline"`
+			Paths []struct {
+				Stroke string `xml:"stroke,attr"`
+			} `xml:"path"`
+		}
+		if err := xml.Unmarshal(diagram.Bytes(), &svg); err != nil {
+			t.Fatalf("Expected an SVG, got %v", err)
+		}
+
+		// every agent has a trajectory, and a red cross for each one destroyed
+		agents := make(map[string]bool)
+		for _, polyline := range svg.Polylines {
+			agents[polyline.Title] = true
+		}
+		if uint64(len(agents)) != result.TeamSize {
+			t.Errorf("(black hole %d) Expected a trajectory for each of the %d agents, got %d", i, result.TeamSize, len(agents))
+		}
+		var crosses uint64
+		for _, path := range svg.Paths {
+			if path.Stroke == "red" {
+				crosses++
+			}
+		}
+		if crosses != result.Destroyed {
+			t.Errorf("(black hole %d) Expected %d agents destroyed, got %d", i, result.Destroyed, crosses)
+		}
+	}
+}
+
+func TestDOT(t *testing.T) {
+	var size uint64 = 12
+
+	for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+		ring := bhs.BuildRing(i, size, true)
+		algorithms.Divide(ring, bhs.NewSynchronousScheduler())
+		var dot bytes.Buffer
+		if err := ring.WriteDOT(&dot); err != nil {
+			t.Fatalf("Expected to write the ring, got %v", err)
+		}
+
+		// every node and link is there, and the black hole is labelled along with a link into it left active
+		graph := dot.String()
+		for id := uint64(0); id < size; id++ {
+			if !strings.Contains(graph, fmt.Sprintf("\t%d -- %d [", id, (id+1)%size)) {
+				t.Errorf("(black hole %d) Expected the link from node %d to the next one", i, id)
+			}
+		}
+		if !strings.Contains(graph, fmt.Sprintf("\t%d [label=\"%d\\nblack hole\"", i, i)) {
+			t.Errorf("(black hole %d) Expected the black hole to be labelled, got %s", i, graph)
+		}
+		if !strings.Contains(graph, "headlabel=active") && !strings.Contains(graph, "taillabel=active") {
+			t.Errorf("(black hole %d) Expected a link left active by the agent destroyed, got %s", i, graph)
+		}
+	}
+	// tracers are called once agents let go of the whiteboard locks, so they may write the ring as they go
+	for _, name := range []string{"Divide", "OptTeamSize"} {
+		algorithm, _ := algorithms.Lookup(name)
+		var ring bhs.Ring
+		tracer := bhs.TracerFunc(func(event bhs.Event) {
+			if event.Kind == bhs.LabelChanged || event.Kind == bhs.UpdateWritten || event.Kind == bhs.UpdateRead {
+				ring.WriteDOT(io.Discard)
+			}
+		})
+		ring = algorithm.Model().BuildRing(7, size, bhs.WithTracer(tracer))
+		done := make(chan bhs.Result, 1)
+		go func() { done <- algorithm.Run(ring, bhs.NewSynchronousScheduler()) }()
+		select {
+		case result := <-done:
+			if result.BlackHole != 7 {
+				t.Errorf("(%s) Expected 7, got %d", name, result.BlackHole)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("(%s) Expected writing the ring from a tracer not to deadlock", name)
+		}
+	}
+}
+
+func TestChecker(t *testing.T) {
+	var size uint64 = 12
+
+	// the algorithms keep to cautious walk, even when agents can't read node IDs
+	for _, algorithm := range algorithms.All() {
+		for _, anonymous := range []bool{false, true} {
+			for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+				checker := bhs.NewChecker(func(violation bhs.Violation) {
+					t.Errorf("(%s) Expected no violation with black hole %d, got %v", algorithm.Name(), i, violation)
+				})
+				options := []bhs.RingOption{bhs.WithTracer(checker)}
+				if anonymous {
+					options = append(options, bhs.Anonymous())
+				}
+				algorithm.Run(algorithm.Model().BuildRing(i, size, options...), bhs.NewSynchronousScheduler())
+			}
+		}
+	}
+
+	// and the checker catches agents that don't, here around the black hole 5
+	checker := bhs.NewChecker(func(violation bhs.Violation) {})
+	bhs.BuildRing(5, size, true, bhs.WithTracer(checker))
+	for _, event := range []bhs.Event{
+		{Kind: bhs.AgentSpawned, Agent: 0, Node: 0},
+		{Kind: bhs.AgentSpawned, Agent: 1, Node: 0},
+		{Kind: bhs.LabelChanged, Agent: 0, Node: 4, Port: bhs.Left, Direction: bhs.Left, Label: 1}, // active
+		{Kind: bhs.AgentMoved, Agent: 0, Node: 4, To: 5, Port: bhs.Left, Direction: bhs.Left},
+		{Kind: bhs.AgentDestroyed, Agent: 0, Node: 5, To: 5},
+		{Kind: bhs.AgentMoved, Agent: 1, Node: 4, To: 5, Port: bhs.Left, Direction: bhs.Left},
+		{Kind: bhs.AgentDestroyed, Agent: 1, Node: 5, To: 5},
+		{Kind: bhs.UpdateWritten, Agent: 1, Node: 3, Unexplored: [2]bhs.NodeID{6, 8}},
+	} {
+		checker.Trace(event)
+	}
+	expected := []bhs.Invariant{bhs.NoCrossingActiveLink, bhs.OneDeathPerActiveLink, bhs.UnexploredSetHasBlackHole}
+	violations := checker.Violations()
+	if len(violations) != len(expected) {
+		t.Fatalf("Expected %d violations, got %v", len(expected), violations)
+	}
+	for i, violation := range violations {
+		if violation.Invariant != expected[i] {
+			t.Errorf("Expected violation %d of %s, got %v", i, expected[i], violation)
+		}
+	}
+}
+
+func TestModelCheck(t *testing.T) {
+	// every schedule of Divide, UnorientedDivide and TokenCount finds the black hole of small rings
+	for _, name := range []string{"Divide", "UnorientedDivide", "TokenCount"} {
+		algorithm, _ := algorithms.Lookup(name)
+		var size uint64 = 5
+		if name == "TokenCount" {
+			size = 4
+		}
+		for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+			report, err := algorithms.ModelCheck(algorithm, i, size, 10000)
+			if err != nil || report.Err != nil || !report.Complete {
+				t.Errorf("(%s) Expected every schedule to be right with black hole %d, got %v after %d runs (complete %t)\n%s", name, i, report.Err, report.Runs, report.Complete, report.Schedule())
+			}
+		}
+	}
+
+	// while OptTeamSize may lose both agents, when they enter the black hole opposite the homebase from both sides
+	algorithm, _ := algorithms.Lookup("OptTeamSize")
+	report, err := algorithms.ModelCheck(algorithm, 2, 4, 10000)
+	if err != nil || report.Err == nil || len(report.Counterexample) == 0 || !strings.Contains(report.Err.Error(), "may only lose 1") {
+		t.Errorf("Expected a schedule where OptTeamSize loses both agents, got %v after %d runs", report.Err, report.Runs)
+	}
+	// a search waiting for what agents that all ended never sent is deadlocked, whatever the time runs take
+	before := runtime.NumGoroutine()
+	silent := func(scheduler bhs.Scheduler) bhs.Result {
+		ring, team := bhs.BuildRing(3, 6, true), bhs.NewTeam()
+		reports := make(chan bhs.NodeID, 2)
+		for _, direction := range []bhs.Direction{bhs.Left, bhs.Right} {
+			agent := team.NewAgent(direction, ring, true, scheduler)
+			team.Add(1)
+			go func() {
+				defer team.Done()
+				defer agent.Terminate()
+				agent.Move(agent.Direction) // but never reports
+			}()
+		}
+		scheduler.Start()
+		return team.Result(bhs.Receive(team, reports), 0, scheduler.Time())
+	}
+	for i := 0; i < 10; i++ {
+		if report := bhs.ModelCheck(silent, func(bhs.Result) error { return nil }, 10); report.Runs != 1 || report.Err == nil || !strings.Contains(report.Err.Error(), "deadlock") {
+			t.Fatalf("Expected the first run to deadlock, got %v after %d runs", report.Err, report.Runs)
+		}
+	}
+	checkLeaks(t, before, "A deadlocked model check")
+
+	// agents still waiting for their turn once a run is rejected end their goroutines, here as the other one never stops
+	report = bhs.ModelCheck(func(scheduler bhs.Scheduler) bhs.Result {
+		ring, team := bhs.BuildRing(3, 6, true), bhs.NewTeam()
+		waiting, endless := team.NewAgent(bhs.Left, ring, true, scheduler), team.NewAgent(bhs.Right, ring, true, scheduler)
+		team.Add(2)
+		go func() {
+			defer team.Done()
+			defer waiting.Terminate()
+			waiting.Move(waiting.Direction)
+		}()
+		go func() {
+			defer team.Done()
+			defer endless.Terminate()
+			for {
+				endless.CountMarks(0)
+			}
+		}()
+		scheduler.Start()
+		return team.Result(0, 0, scheduler.Time())
+	}, func(bhs.Result) error { return nil }, 10)
+	if report.Err == nil || !strings.Contains(report.Err.Error(), "still act") {
+		t.Errorf("Expected the run never to end, got %v after %d runs", report.Err, report.Runs)
+	}
+	checkLeaks(t, before, "A rejected model check")
+
+	// and algorithms relying on time can't be model checked
+	optTime, _ := algorithms.Lookup("OptTime")
+	if _, err := algorithms.ModelCheck(optTime, 2, 4, 10000); err == nil {
+		t.Errorf("Expected OptTime not to be model checked")
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	// runs that return give the same result as without a context
+	var size uint64 = 10
+	for _, algorithm := range algorithms.All() {
+		want := algorithm.Run(algorithm.Model().BuildRing(3, size), bhs.NewSynchronousScheduler())
+		got, err := algorithm.RunContext(context.Background(), algorithm.Model().BuildRing(3, size), bhs.NewSynchronousScheduler())
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("(%s) Expected %+v, got %+v (%v)", algorithm.Name(), want, got, err)
+		}
+	}
+
+	// OptTeamSize waits for ever once a gray hole destroyed both agents, the timeout tells where they were
+	// once it returns, none of their goroutines nor the search's are left behind
+	algorithm, _ := algorithms.Lookup("OptTeamSize")
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := algorithm.RunContext(ctx, algorithm.Model().BuildRing(1, size, bhs.GrayHoleEvery(2)), bhs.NewSynchronousScheduler())
+	var hang *bhs.HangError
+	if !errors.As(err, &hang) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the search to be given up on past the timeout, got %v", err)
+	}
+	want := []bhs.Whereabouts{{Agent: 0, Node: 1, Status: bhs.Lost, Action: bhs.WaitAction}, {Agent: 1, Node: 1, Status: bhs.Lost, Action: bhs.WaitAction}}
+	if !reflect.DeepEqual(hang.Agents, want) {
+		t.Errorf("Expected both agents destroyed on the gray hole, got %v", err)
+	}
+	checkLeaks(t, before, "OptTeamSize past the timeout")
+
+	// Divide leaves an agent waiting for the scheduler or blocked on the gray hole
+	divide, _ := algorithms.Lookup("Divide")
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = divide.RunContext(ctx, bhs.BuildRing(4, size, true, bhs.GrayHoleEvery(2)), bhs.NewSynchronousScheduler())
+	if !errors.As(err, &hang) || len(hang.Agents) != 2 || hang.Agents[0].Status != bhs.Lost || hang.Agents[1].Status == bhs.Lost || hang.Agents[1].Status == bhs.Done {
+		t.Errorf("Expected an agent of Divide destroyed and the other one blocked, got %v", err)
+	}
+	checkLeaks(t, before, "Divide past the timeout")
+
+	// agents waiting for their turn with an adversary are let go too
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = divide.RunContext(ctx, bhs.BuildRing(4, size, true, bhs.GrayHoleEvery(2)), bhs.NewAdversarialScheduler(bhs.RandomPolicy, 1))
+	if !errors.As(err, &hang) {
+		t.Errorf("Expected Divide to be given up on with an adversary, got %v", err)
+	}
+	checkLeaks(t, before, "Divide with an adversary past the timeout")
+
+	// a context done before the search starts
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := algorithm.RunContext(ctx, algorithm.Model().BuildRing(1, size), bhs.NewSynchronousScheduler()); err != context.Canceled {
+		t.Errorf("Expected a cancelled search not to start, got %v", err)
+	}
+}
+
+// checkLeaks fails the test if more goroutines are running than before the search, once they had a moment to exit
+func checkLeaks(t *testing.T, before int, search string) {
+	for wait := 0; runtime.NumGoroutine() > before && wait < 100; wait++ {
+		time.Sleep(time.Millisecond)
+	}
+	if leaked := runtime.NumGoroutine() - before; leaked > 0 {
+		stacks := make([]byte, 1<<16)
+		t.Fatalf("%s left %d goroutines behind:\n%s", search, leaked, stacks[:runtime.Stack(stacks, true)])
+	}
+}
+
+func TestLeaks(t *testing.T) {
+	// every goroutine of an algorithm has returned by the time it does, whatever the scheduler
+	for _, algorithm := range algorithms.All() {
+		for _, size := range []uint64{10, 11} {
+			for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+				before := runtime.NumGoroutine()
+				algorithm.Run(algorithm.Model().BuildRing(i, size), bhs.NewSynchronousScheduler())
+				checkLeaks(t, before, algorithm.Name())
+				if algorithm.Model().CautiousWalk {
+					algorithm.Run(algorithm.Model().BuildRing(i, size), bhs.NewAdversarialScheduler(bhs.RandomPolicy, int64(i)))
+					checkLeaks(t, before, algorithm.Name()+" with an adversary")
+				}
+			}
+		}
+	}
+
+	// even when a gray hole lets agents through, so that several nodes look like the black hole
+	for _, name := range []string{"Group", "OptAvgTime", "TokenCount"} {
+		algorithm, _ := algorithms.Lookup(name)
+		for i := bhs.NodeID(1); i < 20; i++ {
+			before := runtime.NumGoroutine()
+			algorithm.Run(algorithm.Model().BuildRing(i, 20, bhs.GrayHoleEvery(2)), bhs.NewSynchronousScheduler())
+			checkLeaks(t, before, name+" with a gray hole")
+		}
+	}
+
+	before := runtime.NumGoroutine()
+	algorithms.ShadowPairs(bhs.BuildRing(5, 20, true, bhs.BlackHoles(12)), bhs.NewSynchronousScheduler())
+	algorithms.BlackLinkPairs(bhs.BuildRing(5, 20, true, bhs.BlackLink(5)), bhs.NewSynchronousScheduler())
+	algorithms.Scattered(bhs.BuildRing(5, 20, true, bhs.Homebases(0, 8, 13)), bhs.NewSynchronousScheduler())
+	checkLeaks(t, before, "ShadowPairs, BlackLinkPairs or Scattered")
+}
+
+func TestAnimation(t *testing.T) {
+	var size uint64 = 20
+	color.NoColor = true // frames are checked without colours, even from a terminal
+
+	for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+		var frames bytes.Buffer
+		animation := bhs.NewAnimation(&frames, size, 0)
+		result := algorithms.Divide(bhs.BuildRing(i, size, true, bhs.WithTracer(animation)), bhs.NewSynchronousScheduler())
+		animation.Found(result.BlackHole)
+		animation.Draw()
+
+		// a frame per time unit, then the last one with the black hole found where the agent was destroyed
+		drawn := strings.Split(frames.String(), "\033[H\033[2J")
+		if uint64(len(drawn)-1) != result.Time+1 {
+			t.Errorf("(black hole %d) Expected %d frames, got %d", i, result.Time+1, len(drawn)-1)
+		}
+		last := strings.Split(drawn[len(drawn)-1], "\n")
+		if !strings.HasPrefix(last[0], fmt.Sprintf("time %d\t agents 1\t destroyed 1", result.Time)) || strings.Index(last[2], "B") != 5+2*int(i) {
+			t.Errorf("(black hole %d) Expected the black hole found in the last frame, got\n%s", i, drawn[len(drawn)-1])
+		}
+	}
+}
+
+func TestAdversarialSchedulers(t *testing.T) {
+	var size uint64 = 20
+	algos := map[string]func(bhs.Ring, bhs.Scheduler) bhs.Result{"Divide": algorithms.Divide, "Group": algorithms.Group, "OptTeamSize": algorithms.OptTeamSize}
+	policies := []bhs.Policy{bhs.RandomPolicy, bhs.RoundRobinPolicy, bhs.StarvePolicy, bhs.NearBlackHolePolicy}
+
+	for name, algo := range algos {
+		for _, policy := range policies {
+			for seed := int64(1); seed <= 3; seed++ {
+				for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+					result := algo(bhs.BuildRing(i, size, true), bhs.NewAdversarialScheduler(policy, seed))
+					if result.BlackHole != i {
+						t.Errorf("(%s, policy %d, seed %d) Expected %v, got %d", name, policy, seed, i, result.BlackHole)
+					}
+
+					// the same seed must replay the same run
+					replay := algo(bhs.BuildRing(i, size, true), bhs.NewAdversarialScheduler(policy, seed))
+					if !reflect.DeepEqual(result, replay) {
+						t.Errorf("(%s, policy %d, seed %d) Expected replay of %d moves in %d, got %d moves in %d", name, policy, seed, result.Moves, result.Time, replay.Moves, replay.Time)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestTopologies(t *testing.T) {
+	// walk around the first row of a torus with cautious walk, then go down a column
+	torus := bhs.BuildTorus(10, 3, 4, true)
+	agent := bhs.NewAgent(bhs.Left, torus, true, nil)
+	if ok, _ := agent.MoveUntil(0, 3); !ok || agent.Moves != 9 { // 3 cautious steps of 3 moves each
+		t.Errorf("Expected to reach node 3 of the torus in 9 moves, got to node %d in %d moves", agent.Location(), agent.Moves)
+	}
+	if ok, _ := agent.MoveUntil(2, 11); !ok {
+		t.Errorf("Expected to reach node 11 of the torus, got to node %d", agent.Location())
+	}
+	if _, err := agent.Move(1); err == nil || agent.Active {
+		t.Errorf("Expected to fall in the black hole at node 10 of the torus, got to node %d", agent.Location())
+	}
+
+	// flip every bit of a hypercube in turn
+	hypercube := bhs.BuildHypercube(5, 3, false)
+	agent = bhs.NewAgent(bhs.Left, hypercube, false, nil)
+	for bit, expected := range []bhs.NodeID{1, 3, 7} {
+		if agent.Move(bhs.Direction(bit)); agent.Location() != expected {
+			t.Errorf("Expected node %d of the hypercube, got %d", expected, agent.Location())
+		}
+	}
+
+	// go down a tree and back up
+	tree, err := bhs.BuildTree(4, []bhs.NodeID{0, 0, 0, 1, 1}, true)
+	if err != nil {
+		t.Fatalf("Expected a tree, got %v", err)
+	}
+	agent = bhs.NewAgent(bhs.Left, tree, true, nil)
+	if agent.Move(1); agent.Location() != 2 {
+		t.Errorf("Expected node 2 of the tree, got %d", agent.Location())
+	}
+	if agent.Move(0); agent.Location() != 0 {
+		t.Errorf("Expected root of the tree, got %d", agent.Location())
+	}
+	if _, err := agent.Move(2); err == nil {
+		t.Errorf("Expected the root of the tree to only have 2 ports")
+	}
+
+	// parents that don't all lead up to the root make no tree
+	for _, parents := range [][]bhs.NodeID{{0, 1}, {0, 2, 1}, {0, 0, 3, 4, 2}, {0, 5}} {
+		if _, err := bhs.BuildTree(0, parents, true); err == nil {
+			t.Errorf("Expected parents %v to be rejected", parents)
+		}
+	}
+	if _, err := bhs.BuildTree(5, []bhs.NodeID{0, 0, 0, 1, 1}, true); err == nil {
+		t.Errorf("Expected a black hole out of the tree to be rejected")
+	}
+}
+
+func TestUnorientedRing(t *testing.T) {
+	var size uint64 = 20
+
+	for seed := int64(1); seed <= 10; seed++ {
+		ring := bhs.BuildRing(10, size, true, bhs.Unoriented(seed))
+		agent := bhs.NewAgent(bhs.Left, ring, true, nil)
+
+		// the agent keeps going the same way, whatever the port labels of the nodes it goes through
+		agent.Move(bhs.Left)
+		step := agent.Location() // 1 if the agent's left is the next node, 19 if it's the previous one
+		for i := uint64(2); i <= 5; i++ {
+			agent.Move(bhs.Left)
+			if expected := (bhs.NodeID(i) * step) % bhs.NodeID(size); agent.Location() != expected {
+				t.Errorf("(seed %d) Expected node %d, got %d", seed, expected, agent.Location())
+			}
+		}
+	}
+}
+
+func TestUnorientedDivide(t *testing.T) {
+	var size uint64 = 20
+	swapped := false
+
+	// agents only go by ports, so they find the black hole even when the ports of their homebase are swapped
+	for seed := int64(1); seed <= 10; seed++ {
+		for _, anonymous := range []bool{false, true} {
+			for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+				options := []bhs.RingOption{bhs.Unoriented(seed)}
+				if anonymous {
+					options = append(options, bhs.Anonymous())
+				}
+				r := bhs.BuildRing(i, size, true, options...)
+				result := algorithms.UnorientedDivide(r, bhs.NewSynchronousScheduler()).BlackHole
+				if anonymous {
+					result = r.NodeAt(0, result)
+				}
+				if result != i {
+					t.Errorf("(seed %d, anonymous %t) Expected %v, got %d", seed, anonymous, i, result)
+				}
+			}
+		}
+		swapped = swapped || bhs.BuildRing(1, size, true, bhs.Unoriented(seed)).NodeAt(0, 1) == bhs.NodeID(size-1)
+	}
+	if !swapped {
+		t.Errorf("Expected a seed swapping the ports of the homebase")
+	}
+}
+
+func TestAnonymousRing(t *testing.T) {
+	var size uint64 = 20
+
+	// agents count their location from the homebase, so they don't need IDs nor a common sense of direction
+	for _, algorithm := range algorithms.All() {
+		for seed := int64(1); seed <= 4; seed++ {
+			for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+				r := algorithm.Model().BuildRing(i, size, bhs.Anonymous(), bhs.Unoriented(seed))
+				if result := algorithm.Run(r, bhs.NewSynchronousScheduler()).BlackHole; r.NodeAt(0, result) != i {
+					t.Errorf("(%s, seed %d) Expected %v, got %d", algorithm.Name(), seed, i, r.NodeAt(0, result))
+				}
+			}
+		}
+	}
+}
+
+func TestCompactRing(t *testing.T) {
+	// only allocating the nodes agents need changes nothing to the search, whatever the ring
+	for _, algorithm := range algorithms.All() {
+		for _, size := range []uint64{10, 11} {
+			for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+				for _, options := range [][]bhs.RingOption{nil, {bhs.Anonymous(), bhs.Unoriented(3)}} {
+					expected := algorithm.Run(algorithm.Model().BuildRing(i, size, options...), bhs.NewSynchronousScheduler())
+					ring := algorithm.Model().BuildRing(i, size, append(options, bhs.Compact())...)
+					result := algorithm.Run(ring, bhs.NewSynchronousScheduler())
+					if !ring.IsCompact() || ring.NodeAt(0, result.BlackHole) != i {
+						t.Errorf("(%s, black hole %d of %d) Expected the black hole on a compact ring, got %d", algorithm.Name(), i, size, ring.NodeAt(0, result.BlackHole))
+					}
+					sortAgents(expected.Agents)
+					if sortAgents(result.Agents); !reflect.DeepEqual(result, expected) {
+						t.Errorf("(%s, black hole %d of %d) Expected %+v, got %+v", algorithm.Name(), i, size, expected, result)
+					}
+				}
+			}
+		}
+	}
+
+	// the state of a compact ring is written out like any other
+	ring := bhs.BuildRing(5, 12, true, bhs.Compact())
+	algorithms.Divide(ring, bhs.NewSynchronousScheduler())
+	var dot bytes.Buffer
+	if err := ring.WriteDOT(&dot); err != nil || !strings.Contains(dot.String(), "\t11 -- 0 [") || !strings.Contains(dot.String(), "\t5 [label=\"5\\nblack hole\"") {
+		t.Errorf("Expected every node of the compact ring, got %v %s", err, dot.String())
+	}
+
+	// an agent reading the whiteboards of a million nodes on its way around allocates none of them
+	var size uint64 = 1000000
+	ring = bhs.BuildRing(bhs.NodeID(size-1), size, true, bhs.Compact())
+	agent := bhs.NewAgent(bhs.Left, ring, false, nil)
+	var marks uint64
+	memory := bhs.MeasureMemory(func() {
+		for agent.Location() != bhs.NodeID(size-2) {
+			agent.Move(bhs.Left)
+			marks += agent.CountMarks(0)
+		}
+	})
+	if agent.Moves != size-2 || marks != 0 || memory.Allocations > 100 {
+		t.Errorf("Expected %d moves reading blank whiteboards without allocating, got %d moves, %d marks and %+v", size-2, agent.Moves, marks, memory)
+	}
+	if err := agent.WriteMark(0); err != nil || agent.CountMarks(0) != 1 {
+		t.Errorf("Expected the mark on the node once allocated, got %v", err)
+	}
+}
+
+// a million nodes searched in moves linear in their number, the explorers' cautious walk allocates the nodes it writes on
+func BenchmarkShadowPairs1000000(b *testing.B) {
+	var size uint64 = 1000000
+	for n := 0; n < b.N; n++ {
+		memory := bhs.MeasureMemory(func() {
+			if blackHoles, _ := algorithms.ShadowPairs(bhs.BuildRing(bhs.NodeID(size/2), size, true, bhs.Compact()), bhs.NewSynchronousScheduler()); len(blackHoles) != 1 || blackHoles[0] != bhs.NodeID(size/2) {
+				b.Fatalf("Expected black hole %d, got %v", size/2, blackHoles)
+			}
+		})
+		b.ReportMetric(float64(memory.Allocated)/float64(size), "B/node")
+		b.ReportMetric(float64(memory.Allocations)/float64(size), "allocs/node")
+	}
+}
+
+// sortAgents orders the results of agents, which some algorithms create in whatever order their goroutines get to
+func sortAgents(agents []bhs.AgentResult) {
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].Moves < agents[j].Moves || agents[i].Moves == agents[j].Moves && agents[i].Fate < agents[j].Fate
+	})
+}
+
+func TestSequentialScheduler(t *testing.T) {
+	var size uint64 = 20
+
+	// agents that never wait for one another take the same time one after the other as in lockstep rounds
+	for _, algorithm := range algorithms.All() {
+		if !algorithm.Model().Independent {
+			continue
+		}
+		for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+			for _, options := range [][]bhs.RingOption{nil, {bhs.Anonymous(), bhs.Unoriented(3)}, {bhs.Compact()}} {
+				expected := algorithm.Run(algorithm.Model().BuildRing(i, size, options...), bhs.NewSynchronousScheduler())
+				if result := algorithm.Run(algorithm.Model().BuildRing(i, size, options...), bhs.NewSequentialScheduler()); !reflect.DeepEqual(result, expected) {
+					t.Errorf("(%s, black hole %d) Expected %+v, got %+v", algorithm.Name(), i, expected, result)
+				}
+			}
+		}
+	}
+
+	// a compact ring searched one agent after the other keeps neither nodes nor goroutines around
+	size = 2000
+	var ring bhs.Ring
+	var result bhs.Result
+	optTime, _ := algorithms.Lookup("OptTime")
+	goroutines := runtime.NumGoroutine()
+	memory := bhs.MeasureMemory(func() {
+		ring = optTime.Model().BuildRing(bhs.NodeID(size-1), size, bhs.Compact())
+		result = algorithms.OptTime(ring, bhs.NewSequentialScheduler())
+		if runtime.NumGoroutine() != goroutines {
+			t.Errorf("Expected no goroutine for the agents, got %d more", runtime.NumGoroutine()-goroutines)
+		}
+	})
+	if result.BlackHole != bhs.NodeID(size-1) || result.TeamSize != size {
+		t.Errorf("Expected %d agents to find black hole %d, got %+v", size, size-1, result)
+	}
+	if memory.Allocations > 10*size || memory.Live > 64*size {
+		t.Errorf("Expected a few allocations per agent, and only the results to stay live, got %+v", memory)
+	}
+	if ring.Size() != size {
+		t.Errorf("Expected a ring of %d nodes, got %d", size, ring.Size())
+	}
+}
+
+func TestEngine(t *testing.T) {
+	// agents stepped as state machines by the event engine search as their goroutines do in lockstep rounds
+	for _, algorithm := range algorithms.All() {
+		if !algorithm.Machines() {
+			continue
+		}
+		for _, size := range []uint64{10, 11} {
+			for i := bhs.NodeID(1); i < bhs.NodeID(size); i++ {
+				for _, options := range [][]bhs.RingOption{nil, {bhs.Anonymous(), bhs.Unoriented(3)}, {bhs.Compact()}, {bhs.RandomDelays(4, 3)}} {
+					expected := algorithm.Run(algorithm.Model().BuildRing(i, size, options...), bhs.NewSynchronousScheduler())
+					result := algorithm.Run(algorithm.Model().BuildRing(i, size, options...), bhs.NewEngine())
+					sortAgents(expected.Agents)
+					if sortAgents(result.Agents); !reflect.DeepEqual(result, expected) {
+						t.Errorf("(%s, black hole %d of %d) Expected %+v, got %+v", algorithm.Name(), i, size, expected, result)
+					}
+				}
+			}
+		}
+
+		// agents step in the order they were added, so even gray holes destroy the same agents from one run to the next
+		expected := algorithm.Run(algorithm.Model().BuildRing(4, 12, bhs.GrayHole(0.3, 7)), bhs.NewEngine())
+		for run := 0; run < 5; run++ {
+			if result := algorithm.Run(algorithm.Model().BuildRing(4, 12, bhs.GrayHole(0.3, 7)), bhs.NewEngine()); !reflect.DeepEqual(result, expected) {
+				t.Errorf("(%s, run %d) Expected %+v, got %+v", algorithm.Name(), run, expected, result)
+			}
+		}
+	}
+
+	// algorithms without state machines don't run with the engine, rather than running their goroutines in its place
+	group, _ := algorithms.Lookup("Group")
+	if _, err := group.RunContext(context.Background(), group.Model().BuildRing(4, 10), bhs.NewEngine()); err == nil || !strings.Contains(err.Error(), "state machines") {
+		t.Errorf("Expected Group to fail with the engine, got %v", err)
+	}
+	func() {
+		defer func() {
+			if recovered := recover(); recovered == nil {
+				t.Errorf("Expected Group to panic with the engine")
+			}
+		}()
+		group.Run(group.Model().BuildRing(4, 10), bhs.NewEngine())
+	}()
+}